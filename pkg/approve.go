@@ -0,0 +1,94 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/caarlos0/log"
+
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+const (
+	choiceApply       = "apply"
+	choiceHunks       = "select hunks"
+	choiceEdit        = "edit in $EDITOR"
+	choiceSkip        = "skip"
+	choiceSkipForever = "skip until the source changes"
+)
+
+var (
+	approvalChoices = []string{choiceApply, choiceHunks, choiceEdit, choiceSkip, choiceSkipForever}
+)
+
+// approveBlock asks the user whether to apply the update of the block, apply some of its hunks, edit it or skip it.
+// Returns the choice, and the lines to update the block with (the local lines if it's skipped).
+func approveBlock(ctx context.Context, targetPath, blockName string, local, synced []string) (string, []string, error) {
+	question := fmt.Sprintf("Target '%s': What do you want to do with block '%s'?", targetPath, blockName)
+	choice, err := utils.PromptUserSelect(question, approvalChoices)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch choice {
+	case choiceApply:
+		return choice, synced, nil
+	case choiceHunks:
+		lines, err := selectHunks(ctx, blockName, local, synced)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return choice, lines, nil
+	case choiceEdit:
+		edited, err := utils.OpenTextEditor(ctx, strings.Join(synced, "\n")+"\n")
+		if err != nil {
+			return "", nil, err
+		}
+
+		return choice, strings.Split(strings.TrimSuffix(edited, "\n"), "\n"), nil
+	default:
+		return choice, local, nil
+	}
+}
+
+// approveChange asks the user whether to apply a change that is approved as a whole, e.g. inserting or removing
+// a block, or updating a key path
+func approveChange(targetPath, change string) (bool, error) {
+	question := fmt.Sprintf("Target '%s': Do you want to %s?", targetPath, change)
+
+	return utils.PromptUserYesNoQuestion(question, false)
+}
+
+// selectHunks asks the user whether to apply every hunk of the update of the block (like `git add -p`), and
+// returns the local lines with the selected hunks applied
+func selectHunks(ctx context.Context, blockName string, local, synced []string) ([]string, error) {
+	logger := log.FromContext(ctx)
+
+	hunks := diffHunks(local, synced, true)
+	selected := []*hunk{}
+	for i, h := range hunks {
+		logger.Infof("Block '%s': Hunk %d/%d (line %d):\n%s\n", blockName, i+1, len(hunks), h.start+1,
+			linesDiff(local[h.start:h.end], h.lines))
+
+		answer, err := utils.PromptUserYesNoQuestion("Do you want to apply this hunk?", false)
+		if err != nil {
+			return nil, err
+		}
+		if answer {
+			selected = append(selected, h)
+		}
+	}
+
+	return applyHunks(local, 0, len(local), selected), nil
+}
+
+// contentHash returns a hash of the lines, to remember them without storing them
+func contentHash(lines []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -1,21 +1,23 @@
 package pkg
 
 import (
-	"bytes"
 	"fmt"
-	"regexp"
+	"strconv"
 	"strings"
-	"text/template"
 
 	"github.com/pkg/errors"
 	"github.com/samber/lo"
 
+	"github.com/ilaif/goplicate/pkg/config"
 	"github.com/ilaif/goplicate/pkg/utils"
 )
 
 const (
-	ParamName = "name"
-	ParamPos  = "pos"
+	ParamName   = "name"
+	ParamPos    = "pos"
+	ParamParams = "params"
+	ParamLocal  = "local"
+	ParamFrozen = "frozen"
 
 	PosStart = "start"
 	PosEnd   = "end"
@@ -23,33 +25,85 @@ const (
 
 var (
 	PosList = []string{PosStart, PosEnd}
-
-	// regex decomposition:
-	// 1. empty spaces: \s*
-	// 2. identifying comments: (#|\/\/|\/\*|\-\-|<\-\-)
-	// 3. goplicate block format: goplicate_start|end(...params...) or goplicate-start:<name>
-	blockRegex = regexp.MustCompile(`\s*(#|\/\/|\/\*|\-\-|<\-\-)\s*goplicate([_\-](start|end))?(\((.*)\)|:(.*))`)
 )
 
 type Block struct {
-	Name  string
+	Name string
+	// Params the key of the params that the block is rendered with, in addition to the top-level params
+	Params string
+	// Local whether the block is a region that is owned by the target, and is kept when its parent block is synced
+	Local bool
+	// Frozen whether the target block is never synced, even if its source block changes
+	Frozen bool
+	// Lines all the lines of the block, including the ones of its nested blocks
 	Lines []string
+	// Children the blocks that are nested in this block
+	Children Blocks
+
+	// offset the index of the first line of the block in the lines of its parent block
+	offset int
 }
 
 func (b *Block) Render() string {
 	return strings.Join(b.Lines, "\n")
 }
 
-func (b *Block) Compare(lines []string) string {
-	return linesDiff(b.Lines, b.padLines(lines))
+// Compare returns a colored diff between this block and the source block
+func (b *Block) Compare(source *Block) string {
+	return linesDiff(b.Lines, b.merge(source).Lines)
+}
+
+// UnifiedDiff returns a plain unified diff between this block and the source block
+func (b *Block) UnifiedDiff(source *Block) string {
+	return linesUnifiedDiff(b.Lines, b.merge(source).Lines)
 }
 
-func (b *Block) SetLines(lines []string) {
-	b.Lines = b.padLines(lines)
+// Sync replaces this block with the source block, keeping its indentation and local regions
+func (b *Block) Sync(source *Block) {
+	*b = *b.merge(source)
+}
+
+// merge returns the source block, padded to the indentation of this block (according to the first line),
+// with the nested local regions of this block in place of the ones of the source
+func (b *Block) merge(source *Block) *Block {
+	return mergeBlock(b, source, b.indentAddition(source.Lines))
+}
+
+// mergeBlock returns the source block, indented by indentAddition, where every local region that also exists in
+// the target, and every region that is frozen in the target, is replaced with the one of the target
+func mergeBlock(target, source *Block, indentAddition int) *Block {
+	merged := &Block{Name: source.Name, Params: source.Params, Local: source.Local, offset: source.offset}
+	lines := []string{}
+	prev := 0
+	for _, child := range source.Children {
+		lines = append(lines, indentLines(source.Lines[prev:child.offset], indentAddition)...)
+
+		var mergedChild *Block
+		if targetChild := target.Children.find(child.Name); targetChild != nil && (child.Local || targetChild.Frozen) {
+			mergedChild = &Block{}
+			*mergedChild = *targetChild
+		} else {
+			mergedChild = mergeBlock(target, child, indentAddition)
+		}
+		mergedChild.offset = len(lines)
+		lines = append(lines, mergedChild.Lines...)
+		merged.Children = append(merged.Children, mergedChild)
+
+		prev = child.offset + len(child.Lines)
+	}
+	merged.Lines = append(lines, indentLines(source.Lines[prev:], indentAddition)...)
+
+	return merged
 }
 
 // padLines add a base indentation to match the one in this block (according to the first line)
 func (b *Block) padLines(lines []string) []string {
+	return indentLines(lines, b.indentAddition(lines))
+}
+
+// indentAddition returns the indentation to add to the lines to match the one in this block
+// (according to the first line)
+func (b *Block) indentAddition(lines []string) int {
 	ourIndent := 0
 	if len(b.Lines) > 0 {
 		ourIndent = utils.CountLeadingSpaces(b.Lines[0])
@@ -58,18 +112,22 @@ func (b *Block) padLines(lines []string) []string {
 	if len(lines) > 0 {
 		theirIndent = utils.CountLeadingSpaces(lines[0])
 	}
-	indentAddition := ourIndent - theirIndent
 
-	paddedLines := make([]string, len(lines))
+	return ourIndent - theirIndent
+}
+
+func indentLines(lines []string, indentAddition int) []string {
+	indentedLines := make([]string, len(lines))
 	for i, l := range lines {
 		if indentAddition > 0 {
-			paddedLines[i] = strings.Repeat(" ", indentAddition) + l
+			indentedLines[i] = strings.Repeat(" ", indentAddition) + l
 		} else {
-			paddedLines[i] = l[-indentAddition:]
+			// Lines that are indented less than the first one (e.g. empty lines) lose only their indentation
+			indentedLines[i] = l[lo.Min([]int{-indentAddition, utils.CountLeadingSpaces(l)}):]
 		}
 	}
 
-	return paddedLines
+	return indentedLines
 }
 
 type Blocks []*Block
@@ -78,6 +136,21 @@ func (b *Blocks) add(block *Block) {
 	*b = append(*b, block)
 }
 
+// find returns the block with the given name, searching the nested blocks as well
+func (b Blocks) find(name string) *Block {
+	for _, block := range b {
+		if block.Name == name {
+			return block
+		}
+
+		if nested := block.Children.find(name); nested != nil {
+			return nested
+		}
+	}
+
+	return nil
+}
+
 func (b *Blocks) Get(name string) *Block {
 	if name == "" {
 		return nil
@@ -98,113 +171,212 @@ func (b *Blocks) Render() string {
 	}), "\n")
 }
 
-func parseBlocksFromFile(filename string, params map[string]interface{}) (Blocks, error) {
+// parseBlocksFromFile parses the blocks of the file, using the custom markers if given. If params are given, every
+// named block is rendered as a template with them.
+func parseBlocksFromFile(filename string, markers *config.Markers, params map[string]interface{}) (Blocks, error) {
 	fileBytes, err := utils.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	var s string
-	if params != nil {
-		t, err := template.New("parse-blocks-tpl").Parse(string(fileBytes))
-		if err != nil {
-			return nil, errors.Wrapf(err, "Failed to parse template for file '%s'", filename)
+	parseMarker := newMarkerParser(filename, markers)
+	lines := strings.Split(string(fileBytes), "\n")
+
+	blocks, err := parseBlocksFromLines(lines, parseMarker)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse blocks in '%s'", filename)
+	}
+
+	if params == nil {
+		return blocks, nil
+	}
+
+	for _, block := range blocks {
+		if block.Name == "" {
+			continue
 		}
 
-		var tpl bytes.Buffer
-		if err := t.Option("missingkey=error").Execute(&tpl, params); err != nil {
-			return nil, errors.Wrapf(err, "Failed to execute template for file '%s'", filename)
+		if err := block.render(params); err != nil {
+			return nil, errors.Wrapf(err, "Failed to render block '%s' of file '%s'", block.Name, filename)
 		}
+	}
 
-		s = tpl.String()
-	} else {
-		s = string(fileBytes)
+	// Rendering can change the lines of the blocks, so the nested blocks are parsed again
+	blocks, err = parseBlocksFromLines(strings.Split(blocks.Render(), "\n"), parseMarker)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse rendered blocks in '%s'", filename)
 	}
 
-	lines := strings.Split(s, "\n")
+	return blocks, nil
+}
+
+// render renders the lines of the block as a template with the params.
+// If the block has its own params key, the params under it take precedence over the ones of its parent block
+// (or the top-level ones).
+func (b *Block) render(params map[string]interface{}) error {
+	data := params
+	if b.Params != "" {
+		blockParams, ok := params[b.Params].(map[string]interface{})
+		if !ok {
+			return errors.Errorf("Params '%s' must be a map", b.Params)
+		}
+		data = mergeParams(params, blockParams, config.MergeDeep)
+	}
 
-	blocks, err := parseBlocksFromLines(lines)
+	lines, err := b.renderLines(data)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to parse blocks in '%s'", filename)
+		return err
+	}
+	b.Lines = lines
+
+	return nil
+}
+
+// renderLines returns the lines of the block rendered as a template with the data. The nested blocks that have
+// their own params key are rendered with their params, so the lines around them are rendered separately.
+func (b *Block) renderLines(data map[string]interface{}) ([]string, error) {
+	if !lo.SomeBy(b.Children, func(child *Block) bool { return child.hasParams() }) {
+		rendered, err := renderTemplate(b.Name, b.Render(), data)
+		if err != nil {
+			return nil, err
+		}
+
+		return strings.Split(rendered, "\n"), nil
 	}
 
-	return blocks, err
+	lines := []string{}
+	renderText := func(text []string) error {
+		if len(text) == 0 {
+			return nil
+		}
+
+		rendered, err := renderTemplate(b.Name, strings.Join(text, "\n"), data)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, strings.Split(rendered, "\n")...)
+
+		return nil
+	}
+
+	prev := 0
+	for _, child := range b.Children {
+		if err := renderText(b.Lines[prev:child.offset]); err != nil {
+			return nil, err
+		}
+
+		renderedChild := &Block{}
+		*renderedChild = *child
+		if err := renderedChild.render(data); err != nil {
+			return nil, errors.Wrapf(err, "Failed to render nested block '%s'", child.Name)
+		}
+		lines = append(lines, renderedChild.Lines...)
+
+		prev = child.offset + len(child.Lines)
+	}
+
+	if err := renderText(b.Lines[prev:]); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
 }
 
-func parseBlocksFromLines(lines []string) (Blocks, error) {
+// hasParams whether the block or one of its nested blocks has its own params key
+func (b *Block) hasParams() bool {
+	return b.Params != "" || lo.SomeBy(b.Children, func(child *Block) bool { return child.hasParams() })
+}
+
+// parseBlocksFromLines parses the lines into top-level blocks, with the named blocks nested in them as children.
+// The lines between top-level named blocks are returned as unnamed blocks.
+func parseBlocksFromLines(lines []string, parseMarker markerParser) (Blocks, error) {
 	blocks := Blocks{}
 
-	var startI int
-	var curBlock *Block
+	// openBlocks the stack of the named blocks that were started and not ended yet, along with their start indexes
+	type openBlock struct {
+		block *Block
+		start int
+	}
+	openBlocks := []*openBlock{}
+
+	textStart := 0
 	for i, l := range lines {
-		params, err := parseBlockComment(l)
+		params, err := parseMarker(l)
 		if err != nil {
-			return nil, err
+			return nil, &lineError{line: i + 1, err: err}
 		} else if params == nil {
-			// if not a block comment, open an empty block
-			if curBlock == nil {
-				curBlock = &Block{Name: ""}
-			}
-
 			continue
 		}
 
-		if params.pos == PosStart && curBlock != nil && curBlock.Name == "" {
-			// an empty block should be closed before processing the comment
-			curBlock.Lines = lines[startI:i]
-			blocks.add(curBlock)
-			startI = i
-			curBlock = nil
-		}
-
-		switch {
-		case params.pos == PosStart && curBlock == nil:
-			// if we see a block start with a nil curBlock, we'll initialize a new one
-			curBlock = &Block{Name: params.name}
-		case params.pos == PosEnd && curBlock != nil:
-			// if we see a block end with a currently active curBlock, we'll close it
-			curBlock.Lines = lines[startI : i+1]
-			blocks.add(curBlock)
-			startI = i + 1
-			curBlock = nil
-		default:
-			return nil, errors.Errorf("Every block must have a position and cannot be nested "+
-				"or interleaved with other blocks. Params: '%+v'", params)
+		switch params.pos {
+		case PosStart:
+			if len(openBlocks) == 0 && i > textStart {
+				// the lines before a top-level block are an unnamed block
+				blocks.add(&Block{Name: "", Lines: lines[textStart:i]})
+			}
+
+			block := &Block{Name: params.name, Params: params.params, Local: params.local, Frozen: params.frozen}
+			openBlocks = append(openBlocks, &openBlock{block: block, start: i})
+		case PosEnd:
+			if len(openBlocks) == 0 {
+				return nil, &lineError{line: i + 1, err: errors.Errorf("Block '%s' ends without a 'start' position",
+					params.name)}
+			}
+
+			current := openBlocks[len(openBlocks)-1]
+			if params.name != "" && params.name != current.block.Name {
+				return nil, &lineError{line: i + 1, err: errors.Errorf(
+					"Block '%s' ends before its nested block '%s'. Blocks cannot be interleaved",
+					params.name, current.block.Name)}
+			}
+			openBlocks = openBlocks[:len(openBlocks)-1]
+			current.block.Lines = lines[current.start : i+1]
+
+			if len(openBlocks) == 0 {
+				blocks.add(current.block)
+				textStart = i + 1
+			} else {
+				parent := openBlocks[len(openBlocks)-1]
+				current.block.offset = current.start - parent.start
+				parent.block.Children.add(current.block)
+			}
 		}
 	}
 
-	if curBlock != nil {
-		if curBlock.Name == "" {
-			curBlock.Lines = lines[startI:]
-			blocks.add(curBlock)
-		} else {
-			return nil, errors.Errorf("Every block must have an 'end' position")
-		}
+	if len(openBlocks) > 0 {
+		unclosed := openBlocks[len(openBlocks)-1]
+
+		return nil, &lineError{line: unclosed.start + 1, err: errors.Errorf(
+			"Every block must have an 'end' position, but block '%s' doesn't", unclosed.block.Name)}
+	}
+
+	if textStart < len(lines) {
+		blocks.add(&Block{Name: "", Lines: lines[textStart:]})
 	}
 
 	return blocks, nil
 }
 
-type blockParams struct {
-	name string
-	pos  string
+// lineError an error at a line of the parsed lines
+type lineError struct {
+	line int
+	err  error
 }
 
-func parseBlockComment(l string) (*blockParams, error) {
-	matches := blockRegex.FindStringSubmatch(l)
-	if len(matches) != 7 {
-		// if not a block comment, return nil
-		return nil, nil
-	}
+func (e *lineError) Error() string {
+	return fmt.Sprintf("Line %d: %s", e.line, e.err)
+}
 
-	startEndBlock := matches[3]
-	paramsStr := matches[5]
-	if matches[6] != "" {
-		// Assume the format is "goplicate-start:<name>""
-		paramsStr = fmt.Sprintf("name=%s", matches[6])
-	}
+func (e *lineError) Unwrap() error {
+	return e.err
+}
 
-	return parseBlockParams(startEndBlock, paramsStr)
+type blockParams struct {
+	name   string
+	pos    string
+	params string
+	local  bool
+	frozen bool
 }
 
 func parseBlockParams(startEndBlock string, params string) (*blockParams, error) {
@@ -226,6 +398,20 @@ func parseBlockParams(startEndBlock string, params string) (*blockParams, error)
 			bp.name = paramValue
 		case "pos":
 			bp.pos = paramValue
+		case "params":
+			bp.params = paramValue
+		case "local":
+			local, err := strconv.ParseBool(paramValue)
+			if err != nil {
+				return nil, errors.Errorf("Block parameter 'local' must be a boolean, got '%s'", paramValue)
+			}
+			bp.local = local
+		case "frozen":
+			frozen, err := strconv.ParseBool(paramValue)
+			if err != nil {
+				return nil, errors.Errorf("Block parameter 'frozen' must be a boolean, got '%s'", paramValue)
+			}
+			bp.frozen = frozen
 		default:
 			return nil, errors.Errorf("Unknown block parameter name '%s'", p)
 		}
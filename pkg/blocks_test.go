@@ -1,10 +1,14 @@
 package pkg
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/ilaif/goplicate/pkg/config"
 	"github.com/ilaif/goplicate/pkg/utils"
 )
 
@@ -76,7 +80,7 @@ func TestParseBlocksFromFile(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.file, func(t *testing.T) {
-			blocks, err := parseBlocksFromFile(test.file, nil)
+			blocks, err := parseBlocksFromFile(test.file, nil, nil)
 			a.NoError(err)
 
 			a.Equal(test.expectedBlocks, blocks)
@@ -156,3 +160,244 @@ func TestBlocksPadding(t *testing.T) {
 		}
 	}
 }
+
+func TestParseBlocksFromFile_Templated(t *testing.T) {
+	a := assert.New(t)
+
+	blocks, err := parseBlocksFromFile("testdata/blocks/templated.yaml", nil, map[string]interface{}{
+		"name":   "app",
+		"env":    "stagingEnv",
+		"url":    "https://example.com",
+		"labels": map[string]interface{}{"team": "infra"},
+		"service": map[string]interface{}{
+			"name": "api",
+			"port": 8080,
+		},
+	})
+	a.NoError(err)
+
+	a.Equal(Blocks{
+		{Name: "", Lines: []string{"name: {{ .name }}"}},
+		{Name: "funcs", Lines: []string{
+			"# goplicate-start:funcs",
+			"name: APP",
+			"env: staging_env",
+			"image: latest",
+			"host: example.com",
+			"labels:",
+			"  team: infra",
+			"# goplicate-end:funcs",
+		}},
+		{Name: "service", Params: "service", Lines: []string{
+			"# goplicate-start(name=service,params=service)",
+			"name: api",
+			"port: 8080",
+			"# goplicate-end(name=service)",
+		}},
+		{Name: "", Lines: []string{""}},
+	}, blocks)
+}
+
+func TestParseBlocksFromLines_Markers(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		markers  *config.Markers
+		start    string
+		end      string
+		error    string
+	}{
+		{name: "html", filename: "index.html", start: "<!-- goplicate-start:common -->",
+			end: "<!-- goplicate-end:common -->"},
+		{name: "html without spaces", filename: "README.md", start: "<!--goplicate-start:common-->",
+			end: "<!--goplicate-end:common-->"},
+		{name: "c block", filename: "style.css", start: "/* goplicate-start(name=common) */",
+			end: "/* goplicate-end(name=common) */"},
+		{name: "lisp", filename: "init.el", start: ";; goplicate-start:common", end: ";; goplicate-end:common"},
+		{name: "erlang", filename: "app.erl", start: "% goplicate-start:common", end: "% goplicate-end:common"},
+		{name: "latex", filename: "main.tex", start: "% goplicate-start:common", end: "% goplicate-end:common"},
+		{name: "vb", filename: "module.vb", start: "' goplicate-start:common", end: "' goplicate-end:common"},
+		{name: "ini", filename: "setup.ini", start: "; goplicate-start:common", end: "; goplicate-end:common"},
+		{name: "jinja", filename: "values.yaml.j2", start: "{# goplicate-start:common #}",
+			end: "{# goplicate-end:common #}"},
+		{name: "legacy html", filename: "README.md", start: "<-- goplicate-start:common -->",
+			end: "<-- goplicate-end:common"},
+		{name: "unknown extension", filename: "config.tpl", start: "// goplicate-start:common",
+			end: "  # goplicate-end:common"},
+		{name: "unknown extension with earlier styles", filename: "config.txt",
+			start: "key: value -- goplicate-start:common", end: "<-- goplicate-end:common"},
+		{name: "trailing marker", filename: "config.yaml", start: "key: value # goplicate-start:common",
+			end: "# goplicate-end:common"},
+		{name: "missing suffix", filename: "index.html", start: "<!-- goplicate-start:common", end: "-->",
+			error: "must be closed with '-->'"},
+		{name: "custom markers", filename: "config.txt", markers: &config.Markers{Start: "@@ begin {name} @@",
+			End: "@@ end @@"}, start: "  @@ begin common @@", end: "  @@ end @@"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := require.New(t)
+
+			lines := []string{"before", test.start, "value", test.end, "after"}
+			blocks, err := parseBlocksFromLines(lines, newMarkerParser(test.filename, test.markers))
+			if test.error != "" {
+				r.ErrorContains(err, test.error)
+
+				return
+			}
+			r.NoError(err)
+
+			r.Equal(Blocks{
+				{Name: "", Lines: []string{"before"}},
+				{Name: "common", Lines: []string{test.start, "value", test.end}},
+				{Name: "", Lines: []string{"after"}},
+			}, blocks)
+		})
+	}
+}
+
+func TestParseBlocksFromLines_StyleOfExtension(t *testing.T) {
+	r := require.New(t)
+
+	// `--` is not a comment in YAML files
+	blocks, err := parseBlocksFromLines([]string{"-- goplicate-start:common", "-- goplicate-end:common"},
+		newMarkerParser("config.yaml", nil))
+	r.NoError(err)
+	r.Equal(Blocks{{Name: "", Lines: []string{"-- goplicate-start:common", "-- goplicate-end:common"}}}, blocks)
+}
+
+func TestParseBlocksFromLines_Nested(t *testing.T) {
+	r := require.New(t)
+
+	lines := []string{
+		"# goplicate-start:ci",
+		"on: push",
+		"# goplicate-start(name=jobs,local=true)",
+		"jobs: []",
+		"# goplicate-end:jobs",
+		"# goplicate-end:ci",
+	}
+	blocks, err := parseBlocksFromLines(lines, newMarkerParser("ci.yml", nil))
+	r.NoError(err)
+	r.Len(blocks, 1)
+	r.Equal(lines, blocks[0].Lines)
+	r.Equal(Blocks{{Name: "jobs", Local: true, Lines: lines[2:5], offset: 2}}, blocks[0].Children)
+
+	_, err = parseBlocksFromLines([]string{
+		"# goplicate-start:a",
+		"# goplicate-start:b",
+		"# goplicate-end:a",
+		"# goplicate-end:b",
+	}, newMarkerParser("ci.yml", nil))
+	r.ErrorContains(err, "cannot be interleaved")
+}
+
+func TestBlockSync_LocalRegions(t *testing.T) {
+	r := require.New(t)
+
+	parse := func(lines ...string) *Block {
+		blocks, err := parseBlocksFromLines(lines, newMarkerParser("ci.yml", nil))
+		r.NoError(err)
+		r.Len(blocks, 1)
+
+		return blocks[0]
+	}
+
+	target := parse(
+		"  # goplicate-start:ci",
+		"  on: push",
+		"  # goplicate-start(name=jobs,local=true)",
+		"  jobs:",
+		"    - my-job",
+		"  # goplicate-end:jobs",
+		"  # goplicate-end:ci",
+	)
+	source := parse(
+		"# goplicate-start:ci",
+		"on: [push, pull_request]",
+		"# goplicate-start(name=jobs,local=true)",
+		"jobs: []",
+		"# goplicate-end:jobs",
+		"# goplicate-start(name=env,local=true)",
+		"env: {}",
+		"# goplicate-end:env",
+		"concurrency: ci",
+		"# goplicate-end:ci",
+	)
+
+	r.Contains(target.UnifiedDiff(source), "+  on: [push, pull_request]")
+	r.NotContains(target.UnifiedDiff(source), "jobs: []")
+
+	target.Sync(source)
+	r.Equal([]string{
+		"  # goplicate-start:ci",
+		"  on: [push, pull_request]",
+		"  # goplicate-start(name=jobs,local=true)",
+		"  jobs:",
+		"    - my-job",
+		"  # goplicate-end:jobs",
+		"  # goplicate-start(name=env,local=true)",
+		"  env: {}",
+		"  # goplicate-end:env",
+		"  concurrency: ci",
+		"  # goplicate-end:ci",
+	}, target.Lines)
+	r.Len(target.Children, 2)
+	r.Equal(2, target.Children[0].offset)
+	r.Equal(6, target.Children[1].offset)
+	r.Equal(target.Lines[6:9], target.Children[1].Lines)
+
+	// Syncing again is a no-op
+	r.Empty(target.Compare(source))
+}
+
+func TestParseBlocksFromFile_TemplatedNestedParams(t *testing.T) {
+	r := require.New(t)
+
+	filename := filepath.Join(t.TempDir(), "nested.yaml")
+	r.NoError(os.WriteFile(filename, []byte("# goplicate-start:outer\n"+
+		"name: {{ .name }}\n"+
+		"# goplicate-start(name=inner,params=inner)\n"+
+		"name: {{ .name }}\n"+
+		"# goplicate-end(name=inner)\n"+
+		"# goplicate-end:outer\n"), 0600))
+
+	blocks, err := parseBlocksFromFile(filename, nil, map[string]interface{}{
+		"name":  "outer",
+		"inner": map[string]interface{}{"name": "inner"},
+	})
+	r.NoError(err)
+	r.Equal([]string{
+		"# goplicate-start:outer",
+		"name: outer",
+		"# goplicate-start(name=inner,params=inner)",
+		"name: inner",
+		"# goplicate-end(name=inner)",
+		"# goplicate-end:outer",
+	}, blocks[0].Lines)
+}
+
+func TestRenderTemplate_Default(t *testing.T) {
+	r := require.New(t)
+
+	data := map[string]interface{}{"tag": "v1", "image": map[string]interface{}{"name": "app"}}
+	tests := map[string]string{
+		`{{ .tag | default "latest" }}`:                                "v1",
+		`{{ .missing | default "latest" }}`:                            "latest",
+		`{{ default "latest" .missing }}`:                              "latest",
+		`{{ .image.missing | default "x" }}`:                           "x",
+		`{{ .missing.nested | default "x" | upper }}`:                  "X",
+		`{{ with .image }}{{ .name | default "x" }}{{ end }}`:          "app",
+		`{{ with .image }}{{ $.missing | default "x" }}{{ end }}`:      "x",
+		`{{ if true }}{{ (.missing | default "y") | upper }}{{ end }}`: "Y",
+	}
+	for text, expected := range tests {
+		rendered, err := renderTemplate("test", text, data)
+		r.NoError(err, text)
+		r.Equal(expected, rendered, text)
+	}
+
+	// Missing keys without a default value are still errors
+	_, err := renderTemplate("test", "{{ .missing }}", data)
+	r.ErrorContains(err, `map has no entry for key "missing"`)
+}
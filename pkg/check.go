@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
+)
+
+// ErrDriftDetected returned when one or more targets are out of date compared to their sources
+var ErrDriftDetected = errors.New("Drift detected")
+
+// Check compares every target of the project residing in projectDir with its source
+// without performing any changes, and returns the results of the drifted targets.
+// If locked is set, sources are compared at the commits recorded in the lock file.
+func Check(ctx context.Context, projectDir string, cloner git.Cloner, locked bool) ([]*TargetResult, error) {
+	cfg, err := config.LoadProjectConfig(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	lockFile, err := config.LoadLockFile(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	cloner = newLockingCloner(cloner, lockFile, locked)
+
+	targets := cfg.Targets
+	if cfg.SyncConfig != nil {
+		targets = append([]config.Target{*cfg.SyncConfig}, targets...)
+	}
+
+	driftedResults := []*TargetResult{}
+	for _, target := range targets {
+		fileTargets, err := ExpandTarget(ctx, projectDir, target, cloner)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Target '%s'", target.Path)
+		}
+
+		for _, fileTarget := range fileTargets {
+			result, err := RunTarget(ctx, projectDir, fileTarget, cloner, true, true, false)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Target '%s'", fileTarget.Path)
+			}
+
+			if result.Drifted() {
+				driftedResults = append(driftedResults, result)
+			}
+		}
+	}
+
+	return driftedResults, nil
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ilaif/goplicate/pkg/git"
+)
+
+func NewCacheCmd() *cobra.Command {
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the persistent cache of cloned repositories",
+	}
+
+	cacheCmd.AddCommand(
+		newCacheListCmd(),
+		newCachePruneCmd(),
+		newCacheClearCmd(),
+	)
+
+	return cacheCmd
+}
+
+func newCacheListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the cached repositories",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cacheDir, err := git.DefaultCacheDir()
+			if err != nil {
+				return err
+			}
+
+			entries, err := git.ListCache(cacheDir)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "REPOSITORY\tREF\tLAST USED\tSIZE\tPATH")
+			for _, entry := range entries {
+				lastUsed := "-"
+				if !entry.LastUsed.IsZero() {
+					lastUsed = entry.LastUsed.Local().Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+					entry.Repository, entry.Ref, lastUsed, formatSize(entry.Size), entry.Path)
+			}
+
+			if err := w.Flush(); err != nil {
+				return errors.Wrap(err, "Failed to write cache entries")
+			}
+
+			return nil
+		},
+	}
+}
+
+func newCachePruneCmd() *cobra.Command {
+	var maxAge time.Duration
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached repositories that were not used recently",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return pruneCache(cmd, time.Now().Add(-maxAge))
+		},
+	}
+
+	pruneCmd.Flags().DurationVar(&maxAge, "max-age", 30*24*time.Hour,
+		"remove repositories that were not used for longer than this duration",
+	)
+
+	return pruneCmd
+}
+
+func newCacheClearCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clear",
+		Short: "Remove all cached repositories",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return pruneCache(cmd, time.Now())
+		},
+	}
+}
+
+// pruneCache removes the cached repositories that were last used before the given time
+func pruneCache(cmd *cobra.Command, before time.Time) error {
+	cacheDir, err := git.DefaultCacheDir()
+	if err != nil {
+		return err
+	}
+
+	removed, err := git.PruneCache(cmd.Context(), cacheDir, before)
+	for _, entry := range removed {
+		log.Infof("Removed '%s' (%s)", entry.Repository, formatSize(entry.Size))
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Removed %d cached repositories", len(removed))
+
+	return nil
+}
+
+// formatSize formats a size in bytes in a human-readable form
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,43 @@
+package cmd_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg/cmd"
+	"github.com/ilaif/goplicate/pkg/cmd/testutils"
+)
+
+func listCache(r *require.Assertions) string {
+	var out bytes.Buffer
+	cacheCmd := cmd.NewCacheCmd()
+	cacheCmd.SetOut(&out)
+	cacheCmd.SetArgs([]string{"list"})
+	r.NoError(cacheCmd.Execute())
+
+	return out.String()
+}
+
+func TestCacheCmd(t *testing.T) {
+	r := require.New(t)
+
+	sourceRepoDir := testutils.CreateGitRepository(t, sharedSettings("1"))
+	projectDir := prepareLockedProject(t, sourceRepoDir)
+
+	r.NotContains(listCache(r), sourceRepoDir)
+
+	runProject(t, projectDir)
+	r.Contains(listCache(r), "file://"+sourceRepoDir)
+
+	pruneCmd := cmd.NewCacheCmd()
+	pruneCmd.SetArgs([]string{"prune"})
+	r.NoError(pruneCmd.Execute())
+	r.Contains(listCache(r), "file://"+sourceRepoDir)
+
+	clearCmd := cmd.NewCacheCmd()
+	clearCmd.SetArgs([]string{"clear"})
+	r.NoError(clearCmd.Execute())
+	r.NotContains(listCache(r), sourceRepoDir)
+}
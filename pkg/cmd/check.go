@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+// ExitCodeDrift the exit code used when `goplicate check` finds out of date targets
+const ExitCodeDrift = 2
+
+func NewCheckCmd() *cobra.Command {
+	var (
+		disableCleanup bool
+		locked         bool
+	)
+
+	checkCmd := &cobra.Command{
+		Use:   "check [project-dir]",
+		Short: "Check that the project is in sync, without performing any changes",
+		Long: "Check that the project in project-dir (the current directory by default) is in sync, " +
+			"without performing any changes.\n" +
+			"Prints the diff of every out of date block and exits with a non-zero code if any target is out of date.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Debug("Executing check command")
+			ctx := cmd.Context()
+
+			workdir, err := utils.ResolveWorkdir(args)
+			if err != nil {
+				return err
+			}
+
+			cloner, err := newCloner()
+			if err != nil {
+				return err
+			}
+			if !disableCleanup {
+				defer cloner.Close()
+			}
+
+			driftedResults, err := pkg.Check(ctx, workdir, cloner, locked)
+			if err != nil {
+				return err
+			}
+
+			if len(driftedResults) == 0 {
+				log.Info("All targets are up to date")
+
+				return nil
+			}
+
+			log.Warn("The following targets are out of date:")
+			log.IncreasePadding()
+			for _, result := range driftedResults {
+				if result.Status == pkg.StatusMissing {
+					log.Warnf("Target '%s': Missing", result.Path)
+				}
+				for _, block := range result.Blocks {
+					if block.Diff != "" {
+						log.Warnf("Target '%s': Block '%s'. Diff:\n%s\n", result.Path, block.Name, block.Diff)
+					}
+				}
+			}
+			log.DecreasePadding()
+
+			return errors.Wrapf(pkg.ErrDriftDetected, "%d target(s) are out of date", len(driftedResults))
+		},
+	}
+
+	checkCmd.Flags().BoolVar(&disableCleanup, "disable-cleanup", false, "disable cleanup of cloned repositories")
+	checkCmd.Flags().BoolVar(&locked, "locked", false,
+		"compare with the exact commits of the source repositories that are recorded in the lock file",
+	)
+
+	return checkCmd
+}
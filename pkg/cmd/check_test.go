@@ -0,0 +1,58 @@
+package cmd_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/caarlos0/log"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/cmd"
+	"github.com/ilaif/goplicate/pkg/cmd/testutils"
+)
+
+func TestCheckCmd_Drifted(t *testing.T) {
+	r := require.New(t)
+
+	defer testutils.PrepareWorkdir(t, "../../examples/simple", "repo-1")()
+
+	var logs bytes.Buffer
+	defer func(logger log.Interface) { log.Log = logger }(log.Log)
+	log.Log = log.New(&logs)
+
+	checkCmd := cmd.NewCheckCmd()
+	checkCmd.SetArgs([]string{})
+
+	r.ErrorIs(checkCmd.Execute(), pkg.ErrDriftDetected)
+
+	testutils.RequireFileContains(r, ".eslintrc.js", "indent: ['error', 4]")
+	r.Contains(logs.String(), "Target '.eslintrc.js': Block 'common-rules'. Diff:")
+	r.Contains(logs.String(), "-    indent: ['error', 4],\n+    indent: ['error', 2],")
+}
+
+func TestCheckCmd_ProjectDir(t *testing.T) {
+	r := require.New(t)
+
+	defer testutils.PrepareWorkdir(t, "../../examples/simple", "")()
+
+	checkCmd := cmd.NewCheckCmd()
+	checkCmd.SetArgs([]string{"repo-1"})
+
+	r.ErrorIs(checkCmd.Execute(), pkg.ErrDriftDetected)
+}
+
+func TestCheckCmd_UpToDate(t *testing.T) {
+	r := require.New(t)
+
+	defer testutils.PrepareWorkdir(t, "../../examples/simple", "repo-1")()
+
+	runCmd := cmd.NewRunCmd()
+	runCmd.SetArgs([]string{"--confirm"})
+	r.NoError(runCmd.Execute())
+
+	checkCmd := cmd.NewCheckCmd()
+	checkCmd.SetArgs([]string{})
+
+	r.NoError(checkCmd.Execute())
+}
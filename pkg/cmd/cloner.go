@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/ilaif/goplicate/pkg/git"
+)
+
+var globalFlagsOpts struct {
+	noCache bool
+}
+
+// newCloner creates a cloner that uses the persistent clone cache, unless it's disabled
+func newCloner() (git.Cloner, error) {
+	if globalFlagsOpts.noCache {
+		return git.NewCloner(), nil
+	}
+
+	cacheDir, err := git.DefaultCacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return git.NewCachedCloner(cacheDir), nil
+}
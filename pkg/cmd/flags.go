@@ -1,35 +1,80 @@
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/config"
 )
 
 var runFlagsOpts struct {
 	dryRun         bool
 	confirm        bool
+	interactive    bool
 	publish        bool
 	allowDirty     bool
 	force          bool
 	stashChanges   bool
+	updateInPlace  bool
+	locked         bool
 	disableCleanup bool
 	baseBranch     string
 	branch         string
 	message        string
+	output         string
+	onlyTargets    []string
+	onlyBlocks     []string
 }
 
 func applyRunFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVar(&runFlagsOpts.dryRun, "dry-run", false, "do not execute any changes")
 	cmd.Flags().BoolVarP(&runFlagsOpts.confirm, "confirm", "y", false, "ask for confirmation")
+	cmd.Flags().BoolVarP(&runFlagsOpts.interactive, "interactive", "i", false,
+		"approve every block (or some of its hunks) on its own, with the choices to edit it or skip it until the "+
+			"source changes",
+	)
 	cmd.Flags().BoolVar(&runFlagsOpts.publish, "publish", false,
-		"publish changes by checking out a new branch, committing, pushing and creating a GitHub pull request",
+		"publish changes by checking out a new branch, committing, pushing and creating a GitHub pull request "+
+			"or a GitLab merge request",
 	)
 	cmd.Flags().BoolVar(&runFlagsOpts.allowDirty, "allow-dirty", false, "allow a dirty working tree when publishing")
 	cmd.Flags().BoolVar(&runFlagsOpts.force, "force", false, "perform all actions even if there are no updates")
 	cmd.Flags().BoolVar(&runFlagsOpts.stashChanges, "stash-changes", false,
 		"if the working tree is dirty, stash changes before running, and restore them when done",
 	)
+	cmd.Flags().BoolVar(&runFlagsOpts.updateInPlace, "update-in-place", false,
+		"if the branch already exists remotely, rebase it and force-push (with lease) instead of recreating it",
+	)
+	cmd.Flags().BoolVar(&runFlagsOpts.locked, "locked", false,
+		"sync source repositories at the exact commits recorded in the lock file ("+config.LockFilename+")",
+	)
 	cmd.Flags().BoolVar(&runFlagsOpts.disableCleanup, "disable-cleanup", false, "disable cleanup of cloned repositories")
 	cmd.Flags().StringVar(&runFlagsOpts.baseBranch, "base", "", "base git branch to perform updates to")
 	cmd.Flags().StringVar(&runFlagsOpts.branch, "branch", "", "name of the new branch to be checked out")
 	cmd.Flags().StringVar(&runFlagsOpts.message, "message", "", "pull request description message. supports markdown.")
+	cmd.Flags().StringSliceVar(&runFlagsOpts.onlyTargets, "only-target", nil,
+		"sync only the targets with these paths or globs (e.g. '.github/workflows/*.yml')",
+	)
+	cmd.Flags().StringSliceVar(&runFlagsOpts.onlyBlocks, "only-block", nil,
+		"sync only the blocks (or key paths) with these names",
+	)
+	cmd.Flags().StringVarP(&runFlagsOpts.output, "output", "o", pkg.OutputText,
+		fmt.Sprintf("output format of the run report to stdout. one of %s", pkg.OutputList),
+	)
+}
+
+func validateRunFlags() error {
+	if !lo.Contains(pkg.OutputList, runFlagsOpts.output) {
+		return errors.Errorf("Flag 'output' must be one of %s", pkg.OutputList)
+	}
+
+	if runFlagsOpts.interactive && runFlagsOpts.confirm {
+		return errors.New("Flags 'interactive' and 'confirm' cannot be used together")
+	}
+
+	return nil
 }
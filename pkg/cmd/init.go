@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+func NewInitCmd() *cobra.Command {
+	var disableCleanup bool
+	opts := &pkg.InitOpts{}
+
+	initCmd := &cobra.Command{
+		Use:   "init <source> [project-dir]",
+		Short: "Scaffold the project config from a shared source repository or directory",
+		Long: "Scaffold the project config from a shared source repository or directory.\n" +
+			"Matches every source file with goplicate blocks with a project file by its path, or by the similarity " +
+			"of their contents, proposes where to insert the markers of the blocks that the project file is missing, " +
+			"and writes the targets into " + config.DefaultProjectConfigFilename + ".",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Debug("Executing init command")
+			ctx := cmd.Context()
+
+			workdir, err := utils.ResolveWorkdir(args[1:])
+			if err != nil {
+				return err
+			}
+
+			cloner, err := newCloner()
+			if err != nil {
+				return err
+			}
+			if !disableCleanup {
+				defer cloner.Close()
+			}
+
+			if _, err := pkg.Init(ctx, workdir, args[0], cloner, opts); err != nil {
+				return err
+			}
+
+			if !opts.DryRun {
+				log.Infof("Created %s", config.DefaultProjectConfigFilename)
+			}
+
+			return nil
+		},
+	}
+
+	initCmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "do not execute any changes")
+	initCmd.Flags().BoolVarP(&opts.Confirm, "confirm", "y", false, "ask for confirmation")
+	initCmd.Flags().BoolVar(&opts.Force, "force", false, "overwrite the project config if it already exists")
+	initCmd.Flags().BoolVar(&disableCleanup, "disable-cleanup", false, "disable cleanup of cloned repositories")
+
+	return initCmd
+}
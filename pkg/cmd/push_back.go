@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+func NewPushBackCmd() *cobra.Command {
+	var disableCleanup bool
+	opts := &pkg.PushBackOpts{}
+
+	pushBackCmd := &cobra.Command{
+		Use:   "push-back <target> <block> [project-dir]",
+		Short: "Push the lines of a target block back into the block of its source",
+		Long: "Push the lines of a target block back into the block of its source.\n" +
+			"Reverts the indentation of the block to the one of the source. " +
+			"If the source is a repository, opens a pull request (or a merge request) with the update in it.",
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Debug("Executing push-back command")
+			ctx := cmd.Context()
+
+			workdir, err := utils.ResolveWorkdir(args[2:])
+			if err != nil {
+				return err
+			}
+
+			cloner, err := newCloner()
+			if err != nil {
+				return err
+			}
+			if !disableCleanup {
+				defer cloner.Close()
+			}
+
+			changeRequest, err := pkg.PushBack(ctx, workdir, args[0], args[1], cloner, opts)
+			if err != nil {
+				return err
+			}
+
+			if changeRequest != nil {
+				log.Infof("Change request: %s", changeRequest.URL)
+			}
+
+			return nil
+		},
+	}
+
+	pushBackCmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "do not execute any changes")
+	pushBackCmd.Flags().BoolVarP(&opts.Confirm, "confirm", "y", false, "ask for confirmation")
+	pushBackCmd.Flags().BoolVar(&opts.Force, "force", false,
+		"push back blocks of templated sources, replacing their template actions with the lines of the target",
+	)
+	pushBackCmd.Flags().StringVar(&opts.BaseBranch, "base", "",
+		"base git branch of the source repository. defaults to the branch of the source",
+	)
+	pushBackCmd.Flags().StringVar(&opts.Branch, "branch", "", "name of the new branch to be checked out")
+	pushBackCmd.Flags().BoolVar(&disableCleanup, "disable-cleanup", false, "disable cleanup of cloned repositories")
+
+	return pushBackCmd
+}
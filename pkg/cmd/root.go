@@ -5,7 +5,10 @@ import (
 	"os"
 
 	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+
+	"github.com/ilaif/goplicate/pkg"
 )
 
 func Execute(version string) {
@@ -13,6 +16,10 @@ func Execute(version string) {
 	ctx := context.Background()
 
 	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		if errors.Is(err, pkg.ErrDriftDetected) {
+			os.Exit(ExitCodeDrift)
+		}
+
 		os.Exit(1)
 	}
 }
@@ -39,10 +46,19 @@ func NewRootCmd(version string) *cobra.Command {
 	}
 
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "verbose logging")
+	rootCmd.PersistentFlags().BoolVar(&globalFlagsOpts.noCache, "no-cache", false,
+		"clone repositories into temporary directories instead of the persistent cache",
+	)
 
 	rootCmd.AddCommand(
 		NewRunCmd(),
 		NewSyncCmd(),
+		NewCheckCmd(),
+		NewUpdateCmd(),
+		NewCacheCmd(),
+		NewPushBackCmd(),
+		NewInitCmd(),
+		NewValidateCmd(),
 	)
 
 	return rootCmd
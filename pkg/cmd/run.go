@@ -5,7 +5,6 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/ilaif/goplicate/pkg"
-	"github.com/ilaif/goplicate/pkg/git"
 	"github.com/ilaif/goplicate/pkg/shared"
 	"github.com/ilaif/goplicate/pkg/utils"
 )
@@ -19,13 +18,20 @@ func NewRunCmd() *cobra.Command {
 			log.Debug("Executing run command")
 			ctx := cmd.Context()
 
-			_, chToOrigWorkdir, err := utils.ChWorkdir(args)
+			if err := validateRunFlags(); err != nil {
+				return err
+			}
+
+			origWorkdir := utils.MustGetwd()
+			workdir, err := utils.ResolveWorkdir(args)
 			if err != nil {
 				return err
 			}
-			defer chToOrigWorkdir()
 
-			cloner := git.NewCloner()
+			cloner, err := newCloner()
+			if err != nil {
+				return err
+			}
 			if !runFlagsOpts.disableCleanup {
 				defer cloner.Close()
 			}
@@ -34,20 +40,31 @@ func NewRunCmd() *cobra.Command {
 				Message: runFlagsOpts.message,
 			}
 
-			if err := pkg.Run(ctx, cloner, sharedState, pkg.NewRunOpts(
+			runOpts := pkg.NewRunOpts(
 				runFlagsOpts.dryRun,
 				runFlagsOpts.confirm,
 				runFlagsOpts.publish,
 				runFlagsOpts.allowDirty,
 				runFlagsOpts.force,
 				runFlagsOpts.stashChanges,
+				runFlagsOpts.updateInPlace,
+				runFlagsOpts.locked,
 				runFlagsOpts.baseBranch,
 				runFlagsOpts.branch,
-			)); err != nil {
+			)
+			runOpts.Interactive = runFlagsOpts.interactive
+			runOpts.OnlyTargets = runFlagsOpts.onlyTargets
+			runOpts.OnlyBlocks = runFlagsOpts.onlyBlocks
+
+			result, err := pkg.Run(ctx, workdir, cloner, sharedState, runOpts)
+
+			report := pkg.NewReport()
+			report.Add(result)
+			if err := report.Write(cmd.OutOrStdout(), runFlagsOpts.output, origWorkdir); err != nil {
 				return err
 			}
 
-			return nil
+			return err
 		},
 	}
 
@@ -1,10 +1,13 @@
 package cmd_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/ilaif/goplicate/pkg"
 	"github.com/ilaif/goplicate/pkg/cmd"
 	"github.com/ilaif/goplicate/pkg/cmd/testutils"
 )
@@ -24,6 +27,31 @@ func TestRunCmd(t *testing.T) {
 	testutils.RequireFileContains(r, ".eslintrc.js", "indent: ['error', 2]")
 }
 
+func TestRunCmd_JSONOutput(t *testing.T) {
+	r := require.New(t)
+
+	defer testutils.PrepareWorkdir(t, "../../examples/simple", "repo-1")()
+
+	var out bytes.Buffer
+	runCmd := cmd.NewRunCmd()
+	runCmd.SetOut(&out)
+	runCmd.SetArgs([]string{"--dry-run", "--output", "json"})
+
+	r.NoError(runCmd.Execute())
+
+	report := &pkg.Report{}
+	r.NoError(json.Unmarshal(out.Bytes(), report))
+	r.Len(report.Projects, 1)
+	r.Len(report.Projects[0].Targets, 1)
+
+	target := report.Projects[0].Targets[0]
+	r.Equal(".eslintrc.js", target.Path)
+	r.Equal(pkg.StatusOutdated, target.Status)
+	r.Len(target.Blocks, 1)
+	r.Equal("common-rules", target.Blocks[0].Name)
+	r.Contains(target.Blocks[0].Diff, "+    indent: ['error', 2],")
+}
+
 func TestRunCmd_RemoteGit(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping test in short mode")
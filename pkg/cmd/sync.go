@@ -1,18 +1,26 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"sync"
+
 	"github.com/caarlos0/log"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"github.com/ilaif/goplicate/pkg"
 	"github.com/ilaif/goplicate/pkg/config"
-	"github.com/ilaif/goplicate/pkg/git"
 	"github.com/ilaif/goplicate/pkg/shared"
 	"github.com/ilaif/goplicate/pkg/utils"
 )
 
 func NewSyncCmd() *cobra.Command {
+	var (
+		concurrency int
+		keepGoing   bool
+	)
+
 	syncCmd := &cobra.Command{
 		Use:   "sync",
 		Short: "Sync multiple projects via a configuration file",
@@ -21,19 +29,33 @@ func NewSyncCmd() *cobra.Command {
 			log.Debug("Executing sync command")
 			ctx := cmd.Context()
 
-			_, chToOrigWorkdir, err := utils.ChWorkdir(args)
+			if err := validateRunFlags(); err != nil {
+				return err
+			}
+
+			if concurrency < 1 {
+				return errors.New("Flag 'concurrency' must be at least 1")
+			}
+
+			if concurrency > 1 && !runFlagsOpts.confirm && !runFlagsOpts.dryRun {
+				return errors.New("Flag 'concurrency' greater than 1 requires either 'confirm' or 'dry-run'")
+			}
+
+			origWorkdir := utils.MustGetwd()
+			workdir, err := utils.ResolveWorkdir(args)
 			if err != nil {
 				return err
 			}
-			defer chToOrigWorkdir()
 
-			cfg, err := config.LoadProjectsConfig()
+			cfg, err := config.LoadProjectsConfig(workdir)
 			if err != nil {
 				return err
 			}
 
-			workdir := utils.MustGetwd()
-			cloner := git.NewCloner()
+			cloner, err := newCloner()
+			if err != nil {
+				return err
+			}
 			if !runFlagsOpts.disableCleanup {
 				defer cloner.Close()
 			}
@@ -42,34 +64,120 @@ func NewSyncCmd() *cobra.Command {
 				Message: runFlagsOpts.message,
 			}
 
-			for _, project := range cfg.Projects {
+			syncProject := func(ctx context.Context, project config.Project) (*pkg.ProjectResult, error) {
+				logger := log.FromContext(ctx)
+
 				projectAbsPath, err := pkg.ResolveSourcePath(ctx, project.Location, workdir, cloner)
 				if err != nil {
-					return errors.Wrap(err, "Failed to resolve source")
-				}
+					err = errors.Wrap(err, "Failed to resolve source")
 
-				log.Infof("Syncing project %s...", projectAbsPath)
-				log.IncreasePadding()
-
-				if err := utils.Chdir(projectAbsPath); err != nil {
-					return err
+					return pkg.NewFailedProjectResult(project.Location.String(), err), err
 				}
 
-				if err := pkg.Run(ctx, cloner, sharedState, pkg.NewRunOpts(
+				logger.Infof("Syncing project %s...", projectAbsPath)
+				logger.IncreasePadding()
+				defer logger.DecreasePadding()
+
+				runOpts := pkg.NewRunOpts(
 					runFlagsOpts.dryRun,
 					runFlagsOpts.confirm,
 					runFlagsOpts.publish,
 					runFlagsOpts.allowDirty,
 					runFlagsOpts.force,
 					runFlagsOpts.stashChanges,
+					runFlagsOpts.updateInPlace,
+					runFlagsOpts.locked,
 					runFlagsOpts.baseBranch,
 					runFlagsOpts.branch,
-				)); err != nil {
-					return errors.Wrapf(err, "Failed to sync project '%s'", projectAbsPath)
+				)
+				runOpts.PublishDefaults = cfg.Publish
+				runOpts.Interactive = runFlagsOpts.interactive
+				runOpts.OnlyTargets = runFlagsOpts.onlyTargets
+				runOpts.OnlyBlocks = runFlagsOpts.onlyBlocks
+
+				result, err := pkg.Run(ctx, projectAbsPath, cloner, sharedState, runOpts)
+				if err != nil {
+					return result, errors.Wrapf(err, "Failed to sync project '%s'", projectAbsPath)
+				}
+
+				logger.Infof("Done syncing project %s", projectAbsPath)
+
+				return result, nil
+			}
+
+			results := make([]*pkg.ProjectResult, len(cfg.Projects))
+			errs := make([]error, len(cfg.Projects))
+
+			var wg sync.WaitGroup
+			var outputMu sync.Mutex
+			var stopOnce sync.Once
+			sem := make(chan struct{}, concurrency)
+			// stop is closed when a project fails, to avoid syncing any further projects (unless keepGoing is set).
+			// Projects that are already being synced are left to complete.
+			stop := make(chan struct{})
+
+		projectsLoop:
+			for i, project := range cfg.Projects {
+				sem <- struct{}{}
+				select {
+				case <-stop:
+					break projectsLoop
+				default:
+				}
+
+				wg.Add(1)
+				go func(i int, project config.Project) {
+					defer wg.Done()
+					defer func() { <-sem }()
+
+					projectCtx := ctx
+					var logBuf bytes.Buffer
+					if concurrency > 1 {
+						// Group the log output of each project by buffering it until the project is done
+						projectCtx = log.NewContext(ctx, newBufferedLogger(&logBuf))
+					}
+
+					results[i], errs[i] = syncProject(projectCtx, project)
+					if errs[i] != nil {
+						if keepGoing {
+							log.FromContext(projectCtx).WithError(errs[i]).Error("Failed to sync project. Continuing")
+						} else {
+							stopOnce.Do(func() { close(stop) })
+						}
+					}
+
+					if concurrency > 1 {
+						outputMu.Lock()
+						_, _ = cmd.ErrOrStderr().Write(logBuf.Bytes())
+						outputMu.Unlock()
+					}
+				}(i, project)
+			}
+
+			wg.Wait()
+
+			report := pkg.NewReport()
+			for _, result := range results {
+				report.Add(result)
+			}
+			if err := report.Write(cmd.OutOrStdout(), runFlagsOpts.output, origWorkdir); err != nil {
+				return err
+			}
+
+			if err := report.WriteSummary(cmd.ErrOrStderr()); err != nil {
+				return err
+			}
+
+			if keepGoing {
+				if failed := report.Failed(); failed > 0 {
+					return errors.Errorf("Failed to sync %d out of %d projects", failed, len(cfg.Projects))
 				}
+			}
 
-				log.DecreasePadding()
-				log.Infof("Done syncing project %s", projectAbsPath)
+			for _, err := range errs {
+				if err != nil {
+					return err
+				}
 			}
 
 			log.Infof("Syncing complete")
@@ -79,6 +187,21 @@ func NewSyncCmd() *cobra.Command {
 	}
 
 	applyRunFlags(syncCmd)
+	syncCmd.Flags().IntVar(&concurrency, "concurrency", 1, "number of projects to sync in parallel")
+	syncCmd.Flags().BoolVar(&keepGoing, "keep-going", false,
+		"continue syncing the remaining projects when a project fails, and fail at the end",
+	)
 
 	return syncCmd
 }
+
+// newBufferedLogger creates a logger that writes to w with the same level as the global logger
+func newBufferedLogger(w *bytes.Buffer) *log.Logger {
+	logger := log.New(w)
+	if globalLogger, ok := log.Log.(*log.Logger); ok {
+		logger.Level = globalLogger.Level
+		logger.Padding = globalLogger.Padding
+	}
+
+	return logger
+}
@@ -1,6 +1,8 @@
 package cmd_test
 
 import (
+	"bytes"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -26,6 +28,69 @@ func TestSyncCmd_Simple(t *testing.T) {
 	testutils.RequireFileContains(r, "../simple/repo-2/.eslintrc.js", "indent: ['error', 2]")
 }
 
+func TestSyncCmd_Concurrency(t *testing.T) {
+	r := require.New(t)
+
+	defer testutils.PrepareWorkdir(t, "../../examples", "projects-simple")()
+
+	syncCmd := cmd.NewSyncCmd()
+	syncCmd.SetArgs([]string{"--confirm", "--concurrency", "2"})
+
+	r.NoError(syncCmd.Execute())
+
+	testutils.RequireFileContains(r, "../simple/repo-1/.eslintrc.js", "indent: ['error', 2]")
+	testutils.RequireFileContains(r, "../simple/repo-2/.eslintrc.js", "indent: ['error', 2]")
+}
+
+func TestSyncCmd_Concurrency_RequiresConfirm(t *testing.T) {
+	r := require.New(t)
+
+	defer testutils.PrepareWorkdir(t, "../../examples", "projects-simple")()
+
+	syncCmd := cmd.NewSyncCmd()
+	syncCmd.SetArgs([]string{"--concurrency", "2"})
+
+	r.ErrorContains(syncCmd.Execute(), "requires either 'confirm' or 'dry-run'")
+}
+
+const projectsConfigWithMissingProject = `projects:
+  - location:
+      path: ../simple/missing-repo
+  - location:
+      path: ../simple/repo-1
+`
+
+func TestSyncCmd_StopsOnError(t *testing.T) {
+	r := require.New(t)
+
+	defer testutils.PrepareWorkdir(t, "../../examples", "projects-simple")()
+	r.NoError(os.WriteFile(".goplicate-projects.yaml", []byte(projectsConfigWithMissingProject), 0600))
+
+	syncCmd := cmd.NewSyncCmd()
+	syncCmd.SetArgs([]string{"--confirm"})
+
+	r.ErrorContains(syncCmd.Execute(), "missing-repo")
+
+	testutils.RequireFileContains(r, "../simple/repo-1/.eslintrc.js", "indent: ['error', 4]")
+}
+
+func TestSyncCmd_KeepGoing(t *testing.T) {
+	r := require.New(t)
+
+	defer testutils.PrepareWorkdir(t, "../../examples", "projects-simple")()
+	r.NoError(os.WriteFile(".goplicate-projects.yaml", []byte(projectsConfigWithMissingProject), 0600))
+
+	var stderr bytes.Buffer
+	syncCmd := cmd.NewSyncCmd()
+	syncCmd.SetErr(&stderr)
+	syncCmd.SetArgs([]string{"--confirm", "--keep-going"})
+
+	r.ErrorContains(syncCmd.Execute(), "Failed to sync 1 out of 2 projects")
+
+	testutils.RequireFileContains(r, "../simple/repo-1/.eslintrc.js", "indent: ['error', 2]")
+	r.Contains(stderr.String(), "1 updated, 0 outdated, 0 unchanged, 1 failed, 0 published")
+}
+
 func TestSyncCmd_RemoteGit(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping test in short mode")
@@ -0,0 +1,47 @@
+package testutils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// RunGit runs a git command in dir and returns its output
+func RunGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	return string(output)
+}
+
+// CreateGitRepository creates a git repository in a temporary directory with an initial commit of the given files
+func CreateGitRepository(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	RunGit(t, dir, "init", "--quiet")
+	RunGit(t, dir, "config", "user.name", "goplicate")
+	RunGit(t, dir, "config", "user.email", "goplicate@example.com")
+	CommitGitFiles(t, dir, files)
+
+	return dir
+}
+
+// CommitGitFiles writes the given files into the repository in dir and commits them.
+// Returns the SHA of the new commit.
+func CommitGitFiles(t *testing.T, dir string, files map[string]string) string {
+	r := require.New(t)
+
+	for path, content := range files {
+		absPath := filepath.Join(dir, path)
+		r.NoError(os.MkdirAll(filepath.Dir(absPath), 0750))
+		r.NoError(os.WriteFile(absPath, []byte(content), 0600))
+	}
+	RunGit(t, dir, "add", ".")
+	RunGit(t, dir, "commit", "--quiet", "-m", "update files")
+
+	return RunGit(t, dir, "rev-parse", "HEAD")[:40]
+}
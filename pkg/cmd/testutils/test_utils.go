@@ -27,8 +27,13 @@ func PrepareWorkdir(t *testing.T, source string, cd string) func() {
 	}
 }
 
+// RequireFileContains requires the file at filepath (relative to the current directory, unless absolute)
+// to contain the given string
 func RequireFileContains(r *require.Assertions, filepath string, contains string) {
-	bytes, err := os.ReadFile(path.Join(utils.MustGetwd(), filepath))
+	if !path.IsAbs(filepath) {
+		filepath = path.Join(utils.MustGetwd(), filepath)
+	}
+	bytes, err := os.ReadFile(filepath)
 	r.NoError(err)
 	contents := string(bytes)
 	r.Contains(contents, contains)
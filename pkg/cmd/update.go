@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"github.com/caarlos0/log"
+	"github.com/spf13/cobra"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+func NewUpdateCmd() *cobra.Command {
+	var disableCleanup bool
+
+	updateCmd := &cobra.Command{
+		Use:   "update",
+		Short: "Lock the source repositories of the project in the current directory to their latest commits",
+		Long: "Lock the source repositories of the project in the current directory to their latest commits.\n" +
+			"Resolves every source and params repository, and records the commits in " + config.LockFilename + ".\n" +
+			"Use `goplicate run --locked` to sync the targets at exactly these commits.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Debug("Executing update command")
+			ctx := cmd.Context()
+
+			workdir, err := utils.ResolveWorkdir(args)
+			if err != nil {
+				return err
+			}
+
+			cloner, err := newCloner()
+			if err != nil {
+				return err
+			}
+			if !disableCleanup {
+				defer cloner.Close()
+			}
+
+			if _, err := pkg.Update(ctx, workdir, cloner); err != nil {
+				return err
+			}
+
+			log.Infof("Updated %s", config.LockFilename)
+
+			return nil
+		},
+	}
+
+	updateCmd.Flags().BoolVar(&disableCleanup, "disable-cleanup", false, "disable cleanup of cloned repositories")
+
+	return updateCmd
+}
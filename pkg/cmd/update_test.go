@@ -0,0 +1,111 @@
+package cmd_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg/cmd"
+	"github.com/ilaif/goplicate/pkg/cmd/testutils"
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
+)
+
+func sharedSettings(value string) map[string]string {
+	return map[string]string{
+		"settings.yaml": "# goplicate-start(name=settings)\nvalue: " + value + "\n# goplicate-end(name=settings)\n",
+	}
+}
+
+// prepareLockedProject creates a project that syncs a block from a local source repository
+func prepareLockedProject(t *testing.T, sourceRepoDir string) string {
+	r := require.New(t)
+
+	t.Setenv(git.CacheDirEnv, t.TempDir())
+	projectDir := t.TempDir()
+	r.NoError(os.WriteFile(filepath.Join(projectDir, config.DefaultProjectConfigFilename), []byte(`targets:
+  - path: settings.yaml
+    source:
+      repository: file://`+sourceRepoDir+`
+      path: settings.yaml
+`), 0600))
+	r.NoError(os.WriteFile(filepath.Join(projectDir, "settings.yaml"), []byte(sharedSettings("0")["settings.yaml"]), 0600))
+
+	return projectDir
+}
+
+func runProject(t *testing.T, projectDir string, args ...string) {
+	runCmd := cmd.NewRunCmd()
+	runCmd.SetArgs(append([]string{projectDir, "--confirm"}, args...))
+	require.NoError(t, runCmd.Execute())
+}
+
+func requireLockedCommit(r *require.Assertions, projectDir, repository, commit string) {
+	lockFile, err := config.LoadLockFile(projectDir)
+	r.NoError(err)
+	r.Equal(commit, lockFile.Get(repository, ""))
+}
+
+func TestUpdateCmd_Locked(t *testing.T) {
+	r := require.New(t)
+
+	sourceRepoDir := testutils.CreateGitRepository(t, sharedSettings("1"))
+	firstCommit := testutils.RunGit(t, sourceRepoDir, "rev-parse", "HEAD")[:40]
+	projectDir := prepareLockedProject(t, sourceRepoDir)
+	sourceRepository := "file://" + sourceRepoDir
+
+	// A regular run syncs the latest commit and locks it
+	runProject(t, projectDir)
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "settings.yaml"), "value: 1")
+	requireLockedCommit(r, projectDir, sourceRepository, firstCommit)
+
+	// A locked run ignores new upstream commits
+	secondCommit := testutils.CommitGitFiles(t, sourceRepoDir, sharedSettings("2"))
+	runProject(t, projectDir, "--locked")
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "settings.yaml"), "value: 1")
+	requireLockedCommit(r, projectDir, sourceRepository, firstCommit)
+
+	// Updating bumps the lock, without syncing the targets
+	updateCmd := cmd.NewUpdateCmd()
+	updateCmd.SetArgs([]string{projectDir})
+	r.NoError(updateCmd.Execute())
+	requireLockedCommit(r, projectDir, sourceRepository, secondCommit)
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "settings.yaml"), "value: 1")
+
+	runProject(t, projectDir, "--locked")
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "settings.yaml"), "value: 2")
+}
+
+func TestRunCmd_LockedCommitPin(t *testing.T) {
+	r := require.New(t)
+
+	sourceRepoDir := testutils.CreateGitRepository(t, sharedSettings("1"))
+	firstCommit := testutils.RunGit(t, sourceRepoDir, "rev-parse", "HEAD")[:40]
+	testutils.CommitGitFiles(t, sourceRepoDir, sharedSettings("2"))
+
+	projectDir := prepareLockedProject(t, sourceRepoDir)
+	configPath := filepath.Join(projectDir, config.DefaultProjectConfigFilename)
+	cfg, err := os.ReadFile(configPath)
+	r.NoError(err)
+	r.NoError(os.WriteFile(configPath, append(cfg, []byte("      commit: "+firstCommit+"\n")...), 0600))
+
+	runProject(t, projectDir)
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "settings.yaml"), "value: 1")
+
+	lockFile, err := config.LoadLockFile(projectDir)
+	r.NoError(err)
+	r.Equal(firstCommit, lockFile.Get("file://"+sourceRepoDir, firstCommit))
+}
+
+func TestRunCmd_LockedNotLocked(t *testing.T) {
+	r := require.New(t)
+
+	sourceRepoDir := testutils.CreateGitRepository(t, sharedSettings("1"))
+	projectDir := prepareLockedProject(t, sourceRepoDir)
+
+	runCmd := cmd.NewRunCmd()
+	runCmd.SetArgs([]string{projectDir, "--confirm", "--locked"})
+	r.ErrorContains(runCmd.Execute(), "is not locked")
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+func NewValidateCmd() *cobra.Command {
+	var disableCleanup bool
+
+	validateCmd := &cobra.Command{
+		Use:   "validate [project-dir]",
+		Short: "Validate the configs, block markers and templates of the project, without performing any changes",
+		Long: "Validate the configs, block markers and templates of the project, without performing any changes.\n" +
+			"Checks " + config.DefaultProjectConfigFilename + " and " + config.DefaultProjectsConfigFilename +
+			" against their JSON schemas (reporting unknown keys), parses every target and source for malformed, " +
+			"unclosed or duplicate blocks, and renders every source block with the params of its target.\n" +
+			"Exits with a non-zero code if any issue is found.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Debug("Executing validate command")
+			ctx := cmd.Context()
+
+			workdir, err := utils.ResolveWorkdir(args)
+			if err != nil {
+				return err
+			}
+
+			cloner, err := newCloner()
+			if err != nil {
+				return err
+			}
+			if !disableCleanup {
+				defer cloner.Close()
+			}
+
+			issues, err := pkg.Validate(ctx, workdir, cloner)
+			if err != nil {
+				return err
+			}
+
+			if len(issues) == 0 {
+				log.Info("No issues found")
+
+				return nil
+			}
+
+			log.Warn("The following issues were found:")
+			log.IncreasePadding()
+			for _, issue := range issues {
+				log.Warn(issue.String())
+			}
+			log.DecreasePadding()
+
+			return errors.Wrapf(pkg.ErrInvalid, "%d issue(s) found", len(issues))
+		},
+	}
+
+	validateCmd.Flags().BoolVar(&disableCleanup, "disable-cleanup", false, "disable cleanup of cloned repositories")
+
+	return validateCmd
+}
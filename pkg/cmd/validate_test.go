@@ -0,0 +1,36 @@
+package cmd_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/cmd"
+	"github.com/ilaif/goplicate/pkg/cmd/testutils"
+)
+
+func TestValidateCmd_Valid(t *testing.T) {
+	r := require.New(t)
+
+	defer testutils.PrepareWorkdir(t, "../../examples/simple", "repo-1")()
+
+	validateCmd := cmd.NewValidateCmd()
+	validateCmd.SetArgs([]string{})
+
+	r.NoError(validateCmd.Execute())
+}
+
+func TestValidateCmd_Invalid(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	r.NoError(os.WriteFile(filepath.Join(dir, ".goplicate.yaml"), []byte("targetz: []\n"), 0600))
+
+	validateCmd := cmd.NewValidateCmd()
+	validateCmd.SetArgs([]string{dir})
+
+	r.ErrorIs(validateCmd.Execute(), pkg.ErrInvalid)
+}
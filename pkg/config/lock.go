@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+const (
+	LockFilename = ".goplicate.lock"
+
+	lockFileHeader = "# This file is generated by goplicate. Do not edit it manually, run `goplicate update` instead.\n"
+)
+
+// LoadLockFile loads the lock file that resides in the given project directory.
+// Returns an empty lock file if it doesn't exist.
+func LoadLockFile(dir string) (*LockFile, error) {
+	lockFile := &LockFile{}
+	path := filepath.Join(dir, LockFilename)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return lockFile, nil
+	}
+
+	if err := utils.ReadYaml(path, lockFile); err != nil {
+		return nil, errors.Wrap(err, "Failed to load lock file")
+	}
+
+	return lockFile, nil
+}
+
+// LockFile records the exact commits that the source repositories were resolved to
+type LockFile struct {
+	Repositories []*LockedRepository `yaml:"repositories"`
+}
+
+// LockedRepository the commit that a repository reference was resolved to
+type LockedRepository struct {
+	Repository string `yaml:"repository"`
+	// Ref the requested tag, branch or commit, or empty for the default branch
+	Ref    string `yaml:"ref,omitempty"`
+	Commit string `yaml:"commit"`
+}
+
+// Get returns the locked commit of the repository reference, or an empty string if it's not locked
+func (l *LockFile) Get(repository, ref string) string {
+	for _, locked := range l.Repositories {
+		if locked.Repository == repository && locked.Ref == ref {
+			return locked.Commit
+		}
+	}
+
+	return ""
+}
+
+// Set records the commit that the repository reference was resolved to
+func (l *LockFile) Set(repository, ref, commit string) {
+	for _, locked := range l.Repositories {
+		if locked.Repository == repository && locked.Ref == ref {
+			locked.Commit = commit
+
+			return
+		}
+	}
+
+	l.Repositories = append(l.Repositories, &LockedRepository{Repository: repository, Ref: ref, Commit: commit})
+	sort.SliceStable(l.Repositories, func(i, j int) bool {
+		if l.Repositories[i].Repository != l.Repositories[j].Repository {
+			return l.Repositories[i].Repository < l.Repositories[j].Repository
+		}
+
+		return l.Repositories[i].Ref < l.Repositories[j].Ref
+	})
+}
+
+// Merge returns a copy of this lock file with the repositories of the other lock file locked on top of it
+func (l *LockFile) Merge(other *LockFile) *LockFile {
+	merged := &LockFile{}
+	for _, lockFile := range []*LockFile{l, other} {
+		for _, locked := range lockFile.Repositories {
+			merged.Set(locked.Repository, locked.Ref, locked.Commit)
+		}
+	}
+
+	return merged
+}
+
+// Equal whether both lock files lock the same repositories to the same commits
+func (l *LockFile) Equal(other *LockFile) bool {
+	if len(l.Repositories) != len(other.Repositories) {
+		return false
+	}
+
+	for _, locked := range l.Repositories {
+		if other.Get(locked.Repository, locked.Ref) != locked.Commit {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Save writes the lock file into the given project directory
+func (l *LockFile) Save(dir string) error {
+	var buf bytes.Buffer
+	buf.WriteString(lockFileHeader)
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(l); err != nil {
+		return errors.Wrap(err, "Failed to marshal lock file")
+	}
+
+	path := filepath.Join(dir, LockFilename)
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return errors.Wrapf(err, "Failed to write lock file '%s'", path)
+	}
+
+	return nil
+}
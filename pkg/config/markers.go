@@ -0,0 +1,35 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MarkerNamePlaceholder the placeholder of the block name in custom markers
+	MarkerNamePlaceholder = "{name}"
+)
+
+// Markers custom patterns of the comments that start and end blocks, instead of the `goplicate-start|end` comments.
+// The patterns are matched literally, and MarkerNamePlaceholder matches the name of the block.
+type Markers struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+func (m *Markers) Validate() error {
+	if !strings.Contains(m.Start, MarkerNamePlaceholder) {
+		return errors.Errorf("'start' must contain the block name placeholder '%s'", MarkerNamePlaceholder)
+	}
+
+	if m.End == "" {
+		return errors.New("'end' cannot be empty")
+	}
+
+	if strings.Count(m.End, MarkerNamePlaceholder) > 1 || strings.Count(m.Start, MarkerNamePlaceholder) > 1 {
+		return errors.Errorf("The block name placeholder '%s' can appear only once", MarkerNamePlaceholder)
+	}
+
+	return nil
+}
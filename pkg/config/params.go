@@ -0,0 +1,58 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+const (
+	// MergeDeep merges nested maps recursively, and replaces lists
+	MergeDeep = "deep"
+	// MergeAppend merges nested maps recursively, and appends lists
+	MergeAppend = "append"
+	// MergeShallow replaces top-level keys
+	MergeShallow = "shallow"
+)
+
+var (
+	MergeStrategies = []string{MergeDeep, MergeAppend, MergeShallow}
+)
+
+// Params a layer of template params, merged on top of the layers before it.
+// Loaded from a YAML, JSON or TOML source file, or given inline with `values`.
+type Params struct {
+	Source `yaml:",inline"`
+	// Values inline params
+	Values map[string]interface{} `yaml:"values,omitempty"`
+	// Merge the strategy of merging the params on top of the layers before them. Defaults to MergeDeep.
+	Merge string `yaml:"merge,omitempty"`
+}
+
+// Inline whether the params are given inline rather than loaded from a source file
+func (p *Params) Inline() bool {
+	return p.Values != nil
+}
+
+func (p *Params) String() string {
+	if p.Inline() {
+		return "inline values"
+	}
+
+	return p.Source.String()
+}
+
+func (p *Params) Validate() error {
+	if p.Inline() {
+		if p.Source != (Source{}) {
+			return errors.New("'values' cannot be specified along with a source")
+		}
+	} else if err := p.Source.Validate(); err != nil {
+		return err
+	}
+
+	if p.Merge != "" && !lo.Contains(MergeStrategies, p.Merge) {
+		return errors.Errorf("'merge' must be one of %s", MergeStrategies)
+	}
+
+	return nil
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"path/filepath"
+
 	"github.com/pkg/errors"
 
 	"github.com/ilaif/goplicate/pkg/utils"
@@ -10,9 +12,10 @@ const (
 	DefaultProjectConfigFilename = ".goplicate.yaml"
 )
 
-func LoadProjectConfig() (*ProjectConfig, error) {
+// LoadProjectConfig loads and validates the project config that resides in the given project directory
+func LoadProjectConfig(dir string) (*ProjectConfig, error) {
 	cfg := &ProjectConfig{}
-	if err := utils.ReadYaml(DefaultProjectConfigFilename, cfg); err != nil {
+	if err := utils.ReadYaml(filepath.Join(dir, DefaultProjectConfigFilename), cfg); err != nil {
 		return nil, errors.Wrap(err, "Failed to load project config")
 	}
 
@@ -25,8 +28,9 @@ func LoadProjectConfig() (*ProjectConfig, error) {
 
 type ProjectConfig struct {
 	Targets    []Target `yaml:"targets"`
-	Hooks      Hooks    `yaml:"hooks"`
-	SyncConfig *Target  `yaml:"sync-config"`
+	Hooks      Hooks    `yaml:"hooks,omitempty"`
+	SyncConfig *Target  `yaml:"sync-config,omitempty"`
+	Publish    Publish  `yaml:"publish,omitempty"`
 }
 
 func (pc *ProjectConfig) Validate() error {
@@ -42,5 +46,9 @@ func (pc *ProjectConfig) Validate() error {
 		}
 	}
 
+	if err := pc.Publish.Validate(); err != nil {
+		return errors.Wrap(err, "'publish' is invalid")
+	}
+
 	return nil
 }
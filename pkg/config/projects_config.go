@@ -1,18 +1,21 @@
 package config
 
 import (
+	"path/filepath"
+
 	"github.com/pkg/errors"
 
 	"github.com/ilaif/goplicate/pkg/utils"
 )
 
 const (
-	defaultProjectsConfigFilename = ".goplicate-projects.yaml"
+	DefaultProjectsConfigFilename = ".goplicate-projects.yaml"
 )
 
-func LoadProjectsConfig() (*ProjectsConfig, error) {
+// LoadProjectsConfig loads and validates the projects config that resides in the given directory
+func LoadProjectsConfig(dir string) (*ProjectsConfig, error) {
 	cfg := &ProjectsConfig{}
-	if err := utils.ReadYaml(defaultProjectsConfigFilename, cfg); err != nil {
+	if err := utils.ReadYaml(filepath.Join(dir, DefaultProjectsConfigFilename), cfg); err != nil {
 		return nil, errors.Wrap(err, "Failed to load projects config")
 	}
 
@@ -25,6 +28,8 @@ func LoadProjectsConfig() (*ProjectsConfig, error) {
 
 type ProjectsConfig struct {
 	Projects []Project `yaml:"projects"`
+	// Publish the default publish settings of all projects. A project's own publish settings take precedence.
+	Publish Publish `yaml:"publish"`
 }
 
 func (pc *ProjectsConfig) Validate() error {
@@ -34,6 +39,10 @@ func (pc *ProjectsConfig) Validate() error {
 		}
 	}
 
+	if err := pc.Publish.Validate(); err != nil {
+		return errors.Wrap(err, "'publish' is invalid")
+	}
+
 	return nil
 }
 
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+)
+
+var ProviderList = []string{ProviderGitHub, ProviderGitLab}
+
+// Publish settings that control how changes are published
+type Publish struct {
+	// Provider the git hosting service to open change requests on. Auto-detected from the remote origin if empty.
+	Provider string `yaml:"provider"`
+	// BaseURL the base URL of a self-hosted git hosting service (e.g. https://gitlab.example.com)
+	BaseURL string `yaml:"base-url"`
+	// Labels to add to the change request
+	Labels []string `yaml:"labels"`
+	// Reviewers usernames to request a review from
+	Reviewers []string `yaml:"reviewers"`
+	// Assignees usernames to assign the change request to
+	Assignees []string `yaml:"assignees"`
+	// UpdateInPlace whether to update an existing change request branch by rebasing it and force-pushing
+	// (with lease), instead of deleting and recreating it
+	UpdateInPlace bool `yaml:"update-in-place"`
+
+	// Branch a template of the name of the branch to publish the changes to
+	Branch string `yaml:"branch"`
+	// CommitMessage a template of the commit message
+	CommitMessage string `yaml:"commit-message"`
+	// Title a template of the change request title. Defaults to the first line of the commit message.
+	Title string `yaml:"title"`
+	// Body a template of the change request body. Supports markdown.
+	Body string `yaml:"body"`
+}
+
+// WithDefaults returns a copy of the publish settings, where every unset setting is taken from defaults
+func (p Publish) WithDefaults(defaults Publish) Publish {
+	if p.Provider == "" {
+		p.Provider = defaults.Provider
+	}
+	if p.BaseURL == "" {
+		p.BaseURL = defaults.BaseURL
+	}
+	if len(p.Labels) == 0 {
+		p.Labels = defaults.Labels
+	}
+	if len(p.Reviewers) == 0 {
+		p.Reviewers = defaults.Reviewers
+	}
+	if len(p.Assignees) == 0 {
+		p.Assignees = defaults.Assignees
+	}
+	p.UpdateInPlace = p.UpdateInPlace || defaults.UpdateInPlace
+	if p.Branch == "" {
+		p.Branch = defaults.Branch
+	}
+	if p.CommitMessage == "" {
+		p.CommitMessage = defaults.CommitMessage
+	}
+	if p.Title == "" {
+		p.Title = defaults.Title
+	}
+	if p.Body == "" {
+		p.Body = defaults.Body
+	}
+
+	return p
+}
+
+func (p *Publish) Validate() error {
+	if p.Provider != "" && !lo.Contains(ProviderList, p.Provider) {
+		return errors.Errorf("'provider' must be one of %s", ProviderList)
+	}
+
+	if p.BaseURL != "" {
+		if err := RepositoryURI(p.BaseURL).Validate(); err != nil {
+			return errors.Wrap(err, "'base-url' is invalid")
+		}
+	}
+
+	for key, text := range map[string]string{
+		"branch":         p.Branch,
+		"commit-message": p.CommitMessage,
+		"title":          p.Title,
+		"body":           p.Body,
+	} {
+		if _, err := template.New(key).Parse(text); err != nil {
+			return errors.Wrapf(err, "'%s' is not a valid template", key)
+		}
+	}
+
+	return nil
+}
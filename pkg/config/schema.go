@@ -0,0 +1,312 @@
+package config
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+const (
+	// SchemaBaseURL the URL that the JSON schemas of the configs are published at
+	SchemaBaseURL = "https://raw.githubusercontent.com/ilaif/goplicate/main/pkg/config/schema/"
+
+	projectConfigSchema  = "goplicate.schema.json"
+	projectsConfigSchema = "goplicate-projects.schema.json"
+)
+
+var (
+	//go:embed schema/*.json
+	schemaFS embed.FS
+
+	yamlErrorRegex = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+	// quotedRegex matches the quoted property names in the messages of the schema validation errors
+	quotedRegex = regexp.MustCompile(`'((?:[^'\\]|\\.)*)'`)
+)
+
+// Issue a problem that was found in a file, at a line of it (or 0 if it's not known)
+type Issue struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s: %s", i.File, i.Message)
+	}
+
+	return fmt.Sprintf("%s:%d: %s", i.File, i.Line, i.Message)
+}
+
+// ValidateProjectConfigFile validates the project config that resides in the given project directory against its
+// JSON schema (e.g. reporting unknown keys) and its rules, without loading it. Returns the issues that were found.
+func ValidateProjectConfigFile(dir string) ([]Issue, error) {
+	doc, issues, err := validateConfigSchema(dir, DefaultProjectConfigFilename, projectConfigSchema)
+	if err != nil || len(issues) > 0 {
+		return issues, err
+	}
+
+	cfg := &ProjectConfig{}
+	if err := doc.Decode(cfg); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode project config")
+	}
+
+	issue := newNodeIssue(DefaultProjectConfigFilename, doc)
+	for i, target := range cfg.Targets {
+		if err := target.Validate(); err != nil {
+			issues = append(issues, issue("/targets/"+strconv.Itoa(i), errors.Wrap(err, "Target is invalid")))
+		}
+	}
+
+	if cfg.SyncConfig != nil {
+		if err := cfg.SyncConfig.Validate(); err != nil {
+			issues = append(issues, issue("/sync-config", errors.Wrap(err, "'sync-config' is invalid")))
+		}
+	}
+
+	if err := cfg.Publish.Validate(); err != nil {
+		issues = append(issues, issue("/publish", errors.Wrap(err, "'publish' is invalid")))
+	}
+
+	return issues, nil
+}
+
+// ValidateProjectsConfigFile validates the projects config that resides in the given directory against its
+// JSON schema (e.g. reporting unknown keys) and its rules, without loading it. Returns the issues that were found.
+func ValidateProjectsConfigFile(dir string) ([]Issue, error) {
+	doc, issues, err := validateConfigSchema(dir, DefaultProjectsConfigFilename, projectsConfigSchema)
+	if err != nil || len(issues) > 0 {
+		return issues, err
+	}
+
+	cfg := &ProjectsConfig{}
+	if err := doc.Decode(cfg); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode projects config")
+	}
+
+	issue := newNodeIssue(DefaultProjectsConfigFilename, doc)
+	for i, project := range cfg.Projects {
+		if err := project.Validate(); err != nil {
+			issues = append(issues, issue("/projects/"+strconv.Itoa(i), errors.Wrap(err, "Project is invalid")))
+		}
+	}
+
+	if err := cfg.Publish.Validate(); err != nil {
+		issues = append(issues, issue("/publish", errors.Wrap(err, "'publish' is invalid")))
+	}
+
+	return issues, nil
+}
+
+// LoadProjectConfigLines returns a function that returns the line of the node at a JSON pointer
+// (e.g. `/targets/0`) in the project config that resides in the given directory, or of its closest existing ancestor
+func LoadProjectConfigLines(dir string) (func(pointer string) int, error) {
+	buf, err := utils.ReadFile(filepath.Join(dir, DefaultProjectConfigFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(buf, doc); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse project config")
+	}
+
+	return func(pointer string) int { return lookupNode(doc, pointer, false).Line }, nil
+}
+
+// validateConfigSchema parses the config file that resides in the given directory and validates it against the
+// JSON schema. Returns the parsed document, and the issues that were found.
+func validateConfigSchema(dir, filename, schemaName string) (*yaml.Node, []Issue, error) {
+	buf, err := utils.ReadFile(filepath.Join(dir, filename))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(buf, doc); err != nil {
+		issue := Issue{File: filename, Message: err.Error()}
+		if matches := yamlErrorRegex.FindStringSubmatch(err.Error()); matches != nil {
+			issue.Line, _ = strconv.Atoi(matches[1])
+			issue.Message = "Invalid YAML: " + matches[2]
+		}
+
+		return nil, []Issue{issue}, nil
+	}
+
+	var value interface{} = map[string]interface{}{}
+	if len(doc.Content) > 0 {
+		if value, err = toJSONValue(doc); err != nil {
+			return nil, []Issue{{File: filename, Line: doc.Content[0].Line, Message: err.Error()}}, nil
+		}
+	}
+
+	schema, err := compileSchema(schemaName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = schema.Validate(value)
+	validationErr := &jsonschema.ValidationError{}
+	if err == nil {
+		return doc, nil, nil
+	} else if !errors.As(err, &validationErr) {
+		return nil, nil, errors.Wrapf(err, "Failed to validate '%s'", filename)
+	}
+
+	issues := []Issue{}
+	for _, leaf := range leafErrors(validationErr) {
+		issues = append(issues, schemaIssues(filename, doc, leaf)...)
+	}
+
+	return doc, issues, nil
+}
+
+// compileSchema compiles the embedded JSON schema with the given name, along with the schemas it refers to
+func compileSchema(schemaName string) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	for _, name := range []string{projectConfigSchema, projectsConfigSchema} {
+		content, err := schemaFS.ReadFile(path.Join("schema", name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read schema '%s'", name)
+		}
+
+		if err := compiler.AddResource(SchemaBaseURL+name, bytes.NewReader(content)); err != nil {
+			return nil, errors.Wrapf(err, "Failed to add schema '%s'", name)
+		}
+	}
+
+	schema, err := compiler.Compile(SchemaBaseURL + schemaName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to compile schema '%s'", schemaName)
+	}
+
+	return schema, nil
+}
+
+// toJSONValue decodes the YAML document into the value that its JSON encoding would decode into
+func toJSONValue(doc *yaml.Node) (interface{}, error) {
+	var value interface{}
+	if err := doc.Decode(&value); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode YAML")
+	}
+
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to convert YAML to JSON")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, errors.Wrap(err, "Failed to convert YAML to JSON")
+	}
+
+	return value, nil
+}
+
+// leafErrors returns the most specific causes of the validation error
+func leafErrors(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+
+	leaves := []*jsonschema.ValidationError{}
+	for _, cause := range err.Causes {
+		leaves = append(leaves, leafErrors(cause)...)
+	}
+
+	return leaves
+}
+
+// schemaIssues returns the issues of the validation error, reporting every unknown key at its own line
+func schemaIssues(filename string, doc *yaml.Node, err *jsonschema.ValidationError) []Issue {
+	if strings.HasSuffix(err.KeywordLocation, "/additionalProperties") {
+		issues := []Issue{}
+		for _, matches := range quotedRegex.FindAllStringSubmatch(err.Message, -1) {
+			keyPointer := err.InstanceLocation + "/" + escapePointerToken(matches[1])
+			issues = append(issues, Issue{
+				File:    filename,
+				Line:    lookupNode(doc, keyPointer, true).Line,
+				Message: fmt.Sprintf("Unknown key '%s'", strings.TrimPrefix(keyPointer, "/")),
+			})
+		}
+
+		return issues
+	}
+
+	return []Issue{newNodeIssue(filename, doc)(err.InstanceLocation, errors.New(err.Message))}
+}
+
+// newNodeIssue returns a function that returns the issue of an error of the node at a JSON pointer in the document
+func newNodeIssue(filename string, doc *yaml.Node) func(pointer string, err error) Issue {
+	return func(pointer string, err error) Issue {
+		message := err.Error()
+		if pointer != "" {
+			message = fmt.Sprintf("'%s': %s", strings.TrimPrefix(pointer, "/"), message)
+		}
+
+		return Issue{File: filename, Line: lookupNode(doc, pointer, false).Line, Message: message}
+	}
+}
+
+// lookupNode returns the node at the JSON pointer (e.g. `/targets/0/path`) in the document, or its key node if key
+// is set. Returns the closest existing ancestor if the pointer doesn't exist.
+func lookupNode(doc *yaml.Node, pointer string, key bool) *yaml.Node {
+	node := doc
+	if len(doc.Content) > 0 {
+		node = doc.Content[0]
+	}
+	if pointer == "" {
+		return node
+	}
+
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for t, token := range tokens {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == token {
+					next = node.Content[i+1]
+					if key && t == len(tokens)-1 {
+						next = node.Content[i]
+					}
+
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+			}
+		}
+
+		if next == nil {
+			return node
+		}
+		node = next
+	}
+
+	return node
+}
+
+func escapePointerToken(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
@@ -3,18 +3,30 @@ package config
 import (
 	"fmt"
 	"net/url"
+	"regexp"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+var (
+	commitRegexp = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+	// scpLikeRepositoryRegexp matches repository URIs of the scp-like form `user@host:path`
+	// (e.g. `git@github.com:org/repo.git`)
+	scpLikeRepositoryRegexp = regexp.MustCompile(`^[^@/\s]+@[^:/\s]+:.+$`)
 )
 
 // Source a path to a file. Can be from a `repository` if one is specified. Otherwise, assumes a local path.
 type Source struct {
 	Path string `yaml:"path"`
 
-	Repository RepositoryURI `yaml:"repository"`
-	Tag        string        `yaml:"tag"`
-	Branch     string        `yaml:"branch"`
-	ClonePath  string        `yaml:"clone-path"`
+	Repository RepositoryURI `yaml:"repository,omitempty"`
+	Tag        string        `yaml:"tag,omitempty"`
+	Branch     string        `yaml:"branch,omitempty"`
+	// Commit pins the repository to an exact commit SHA
+	Commit    string `yaml:"commit,omitempty"`
+	ClonePath string `yaml:"clone-path,omitempty"`
 }
 
 func (s *Source) String() string {
@@ -29,6 +41,9 @@ func (s *Source) String() string {
 	if s.Branch != "" {
 		source += fmt.Sprintf("@(%s)", s.Branch)
 	}
+	if s.Commit != "" {
+		source += fmt.Sprintf("@%s", s.Commit)
+	}
 	if s.Path != "" {
 		source += fmt.Sprintf("/%s", s.Path)
 	}
@@ -36,6 +51,20 @@ func (s *Source) String() string {
 	return source
 }
 
+// Ref returns the git reference (tag, branch or commit) of the source repository,
+// or an empty string for the default branch
+func (s *Source) Ref() string {
+	if s.Tag != "" {
+		return s.Tag
+	}
+
+	if s.Commit != "" {
+		return s.Commit
+	}
+
+	return s.Branch
+}
+
 func (s *Source) Validate() error {
 	if s.Repository == "" && s.Path == "" {
 		return errors.New("At least one of 'repository', 'path' should be specified")
@@ -47,12 +76,16 @@ func (s *Source) Validate() error {
 		}
 	}
 
-	if s.Tag != "" && s.Branch != "" {
-		return errors.New("Only one of 'branch', 'tag' can be specified")
+	if len(lo.Compact([]string{s.Tag, s.Branch, s.Commit})) > 1 {
+		return errors.New("Only one of 'branch', 'tag', 'commit' can be specified")
+	}
+
+	if s.Repository == "" && s.Ref() != "" {
+		return errors.New("'branch', 'tag' or 'commit' require 'repository' to be specified")
 	}
 
-	if s.Repository == "" && (s.Tag != "" || s.Branch != "") {
-		return errors.New("'branch' or 'tag' require 'repository' to be specified")
+	if s.Commit != "" && !commitRegexp.MatchString(s.Commit) {
+		return errors.Errorf("'commit' must be a commit SHA, got '%s'", s.Commit)
 	}
 
 	return nil
@@ -61,9 +94,19 @@ func (s *Source) Validate() error {
 type RepositoryURI string
 
 func (r RepositoryURI) Validate() error {
+	if scpLikeRepositoryRegexp.MatchString(string(r)) {
+		return nil
+	}
+
 	if _, err := url.ParseRequestURI(string(r)); err != nil {
 		return errors.Errorf("'%s' is not a valid URI", string(r))
 	}
 
 	return nil
 }
+
+// IsRemote whether the URI is of a remote repository: a URL (e.g. `https://github.com/org/repo.git`), or of the
+// scp-like form (e.g. `git@github.com:org/repo.git`)
+func (r RepositoryURI) IsRemote() bool {
+	return strings.Contains(string(r), "://") || scpLikeRepositoryRegexp.MatchString(string(r))
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+const (
+	StateFilename = ".goplicate.state"
+
+	stateFileHeader = "# This file is generated by goplicate. Do not edit it manually.\n"
+)
+
+// LoadStateFile loads the state file that resides in the given project directory.
+// Returns an empty state file if it doesn't exist.
+func LoadStateFile(dir string) (*StateFile, error) {
+	stateFile := &StateFile{}
+	path := filepath.Join(dir, StateFilename)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return stateFile, nil
+	}
+
+	if err := utils.ReadYaml(path, stateFile); err != nil {
+		return nil, errors.Wrap(err, "Failed to load state file")
+	}
+
+	return stateFile, nil
+}
+
+// StateFile records the state of the blocks of every target, as of their last sync
+type StateFile struct {
+	// Targets the states of the blocks of every target, by target path and block name
+	Targets map[string]map[string]*BlockState `yaml:"targets"`
+}
+
+// BlockState the state of a target block as of its last sync
+type BlockState struct {
+	// Applied the contents of the block as last synced from the source, which is the base of three-way merges
+	Applied string `yaml:"applied,omitempty"`
+	// Skipped a hash of the source contents of the block that the user chose to skip until the source changes
+	Skipped string `yaml:"skipped,omitempty"`
+}
+
+// Get returns the state of the block of the target, or nil if it has none (or there is no state file)
+func (s *StateFile) Get(targetPath, blockName string) *BlockState {
+	if s == nil {
+		return nil
+	}
+
+	return s.Targets[targetPath][blockName]
+}
+
+// Block returns the state of the block of the target, creating it if it has none
+func (s *StateFile) Block(targetPath, blockName string) *BlockState {
+	if s.Targets == nil {
+		s.Targets = map[string]map[string]*BlockState{}
+	}
+	if s.Targets[targetPath] == nil {
+		s.Targets[targetPath] = map[string]*BlockState{}
+	}
+	if s.Targets[targetPath][blockName] == nil {
+		s.Targets[targetPath][blockName] = &BlockState{}
+	}
+
+	return s.Targets[targetPath][blockName]
+}
+
+// Save writes the state file into the given project directory
+func (s *StateFile) Save(dir string) error {
+	var buf bytes.Buffer
+	buf.WriteString(stateFileHeader)
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(s); err != nil {
+		return errors.Wrap(err, "Failed to marshal state file")
+	}
+
+	path := filepath.Join(dir, StateFilename)
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return errors.Wrapf(err, "Failed to write state file '%s'", path)
+	}
+
+	return nil
+}
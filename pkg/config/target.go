@@ -1,17 +1,89 @@
 package config
 
 import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
 	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+const (
+	// GlobChars the characters that make a target path a glob
+	GlobChars = "*?["
+
+	// RemovedKeep keeps the target blocks that were removed from the source, without warning
+	RemovedKeep = "keep"
+	// RemovedWarn keeps the target blocks that were removed from the source, and warns about them
+	RemovedWarn = "warn"
+	// RemovedRemove removes the target blocks that were removed from the source
+	RemovedRemove = "remove"
+	// RemovedFail fails the target if it has blocks that were removed from the source
+	RemovedFail = "fail"
+)
+
+var (
+	// StructuredExtensions the extensions of the files that support syncing `keys`
+	StructuredExtensions = []string{".yaml", ".yml", ".json", ".toml"}
+
+	RemovedPolicies = []string{RemovedKeep, RemovedWarn, RemovedRemove, RemovedFail}
 )
 
 // Target defines a `path` to apply goplicate block snippets on based on the `source` with the supplied `params`
 type Target struct {
 	Path   string   `yaml:"path"`
 	Source Source   `yaml:"source"`
-	Params []Source `yaml:"params"`
+	Params []Params `yaml:"params,omitempty"`
 	// SyncInitial whether to copy the whole file
 	// from the source if it doesn't exist.
-	SyncInitial bool `yaml:"sync-initial"`
+	SyncInitial bool `yaml:"sync-initial,omitempty"`
+	// Keys dot-separated key paths (e.g. `spec.template.metadata.labels`) to sync from the source document
+	// instead of goplicate blocks. Supported for YAML, JSON and TOML files.
+	Keys []string `yaml:"keys,omitempty"`
+	// Mirror mirrors the files of the source directory into the target directory, or into the files that match the
+	// target glob (e.g. `.github/workflows/*.yml`)
+	Mirror *Mirror `yaml:"mirror,omitempty"`
+	// Markers custom block comments of the target and source files
+	Markers *Markers `yaml:"markers,omitempty"`
+	// Insert the source blocks to insert into the target if it doesn't have them, and where to insert them
+	Insert []Insert `yaml:"insert,omitempty"`
+	// Removed the policy of the target blocks that don't exist in the source. Defaults to RemovedWarn.
+	Removed string `yaml:"removed,omitempty"`
+	// ThreeWayMerge whether to merge the upstream changes of every block into its local edits, using the contents
+	// that were last synced from the source as the base, instead of replacing the block
+	ThreeWayMerge bool `yaml:"three-way-merge,omitempty"`
+	// IncludeBlocks the only blocks (or key paths) to sync, if given
+	IncludeBlocks []string `yaml:"include-blocks,omitempty"`
+	// ExcludeBlocks the blocks (or key paths) not to sync
+	ExcludeBlocks []string `yaml:"exclude-blocks,omitempty"`
+}
+
+// SyncsBlock whether the block (or key path) is synced, according to the include and exclude lists of the target
+func (t *Target) SyncsBlock(name string) bool {
+	if len(t.IncludeBlocks) > 0 && !lo.Contains(t.IncludeBlocks, name) {
+		return false
+	}
+
+	return !lo.Contains(t.ExcludeBlocks, name)
+}
+
+// Insert places a source block that is missing in the target. The block is inserted after the target block
+// `after`, or before the first target line that matches the regex `before`, or at the end of the file.
+type Insert struct {
+	Block  string `yaml:"block"`
+	After  string `yaml:"after,omitempty"`
+	Before string `yaml:"before,omitempty"`
+}
+
+// Mirror options of a directory or glob target
+type Mirror struct {
+	// Sync whether to keep the whole contents of the files in sync, instead of syncing their blocks
+	Sync bool `yaml:"sync,omitempty"`
+	// Create whether to create the files that exist in the source but not in the target
+	Create bool `yaml:"create,omitempty"`
+	// Delete whether to delete the target files that don't exist in the source (e.g. were removed upstream)
+	Delete bool `yaml:"delete,omitempty"`
 }
 
 func (t *Target) Validate() error {
@@ -23,6 +95,53 @@ func (t *Target) Validate() error {
 		return errors.Wrap(err, "'source' is invalid")
 	}
 
+	if t.Mirror == nil && strings.ContainsAny(t.Path, GlobChars) {
+		return errors.New("A glob 'path' requires 'mirror' to be specified")
+	}
+
+	if t.Mirror != nil && t.SyncInitial {
+		return errors.New("'sync-initial' cannot be specified along with 'mirror'. Use 'mirror.create' instead")
+	}
+
+	if len(t.Keys) > 0 && t.Mirror == nil {
+		for _, path := range []string{t.Path, t.Source.Path} {
+			if !lo.Contains(StructuredExtensions, strings.ToLower(filepath.Ext(path))) {
+				return errors.Errorf("'keys' are only supported for files with the extensions %s, got '%s'",
+					StructuredExtensions, path)
+			}
+		}
+
+		for _, key := range t.Keys {
+			if key == "" || lo.Contains(strings.Split(key, "."), "") {
+				return errors.Errorf("Key '%s' must be a dot-separated key path", key)
+			}
+		}
+	}
+
+	if t.Markers != nil {
+		if err := t.Markers.Validate(); err != nil {
+			return errors.Wrap(err, "'markers' is invalid")
+		}
+	}
+
+	if (len(t.Insert) > 0 || t.Removed != "") && len(t.Keys) > 0 {
+		return errors.New("'insert' and 'removed' cannot be specified along with 'keys'")
+	}
+
+	if t.ThreeWayMerge && (len(t.Keys) > 0 || (t.Mirror != nil && t.Mirror.Sync)) {
+		return errors.New("'three-way-merge' cannot be specified along with 'keys' or 'mirror.sync'")
+	}
+
+	for _, insert := range t.Insert {
+		if err := insert.Validate(); err != nil {
+			return errors.Wrapf(err, "Insert of block '%s' is invalid", insert.Block)
+		}
+	}
+
+	if t.Removed != "" && !lo.Contains(RemovedPolicies, t.Removed) {
+		return errors.Errorf("'removed' must be one of %s, got '%s'", RemovedPolicies, t.Removed)
+	}
+
 	for _, param := range t.Params {
 		if err := param.Validate(); err != nil {
 			return errors.Wrap(err, "A param is invalid")
@@ -31,3 +150,21 @@ func (t *Target) Validate() error {
 
 	return nil
 }
+
+func (i *Insert) Validate() error {
+	if i.Block == "" {
+		return errors.New("'block' cannot be empty")
+	}
+
+	if i.After != "" && i.Before != "" {
+		return errors.New("Only one of 'after' and 'before' can be specified")
+	}
+
+	if i.Before != "" {
+		if _, err := regexp.Compile(i.Before); err != nil {
+			return errors.Wrapf(err, "'before' must be a valid regex, got '%s'", i.Before)
+		}
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/samber/lo"
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
@@ -82,6 +83,21 @@ func linesDiff(lines1, lines2 []string) string {
 	return strings.Join(scopedDiff, "\n")
 }
 
+// linesUnifiedDiff get a plain (uncolored) unified diff between two line slices
+func linesUnifiedDiff(lines1, lines2 []string) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:       difflib.SplitLines(strings.Join(lines1, "\n")),
+		B:       difflib.SplitLines(strings.Join(lines2, "\n")),
+		Context: 3,
+	})
+	if err != nil {
+		// writing to an in-memory buffer cannot fail
+		return ""
+	}
+
+	return diff
+}
+
 func padLines(lines []string) string {
 	lines = lo.Map(lines, func(line string, _ int) string { return " " + line })
 
@@ -0,0 +1,432 @@
+package git
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+const (
+	// CacheDirEnv the environment variable that holds the base directory of user-specific cache files
+	CacheDirEnv = "XDG_CACHE_HOME"
+
+	cacheRepositoriesDir  = "repositories"
+	cacheCloneDir         = "repo"
+	cacheMetadataFilename = "metadata.yaml"
+	cacheLockSuffix       = ".lock"
+	cacheLockRetryDelay   = 100 * time.Millisecond
+)
+
+// DefaultCacheDir returns the directory of the persistent clone cache ($XDG_CACHE_HOME/goplicate)
+func DefaultCacheDir() (string, error) {
+	cacheHome := os.Getenv(CacheDirEnv)
+	if cacheHome == "" {
+		var err error
+		if cacheHome, err = os.UserCacheDir(); err != nil {
+			return "", errors.Wrap(err, "Failed to find the user cache directory")
+		}
+	}
+
+	return filepath.Join(cacheHome, "goplicate"), nil
+}
+
+// CacheEntry a repository revision in the clone cache
+type CacheEntry struct {
+	Repository string    `yaml:"repository"`
+	Ref        string    `yaml:"ref,omitempty"`
+	LastUsed   time.Time `yaml:"last-used"`
+	// Path the directory of the entry
+	Path string `yaml:"-"`
+	// Size the disk usage of the entry in bytes
+	Size int64 `yaml:"-"`
+}
+
+// cachedCloner clones repositories into a persistent cache directory that is shared across runs,
+// and refreshes them with a fetch when they're cloned again.
+// Every repository is fetched into a single store, and every ref of it is checked out in its own worktree (entry).
+//
+// File locks allow multiple goplicate processes to share the cache: every run checks out an entry into a worktree
+// of its own, which is locked exclusively until the cloner is closed. A worktree that is in use by another run is
+// never refreshed - the next free one (`repo`, `repo-1`, ...) is checked out instead. The entry is shared while
+// its worktrees are being refreshed and locked exclusively while it's removed, and the store is locked
+// exclusively while fetching.
+type cachedCloner struct {
+	cacheDir string
+
+	mu sync.Mutex
+	// clones the worktrees that were refreshed by this cloner, by repository and ref
+	clones map[cacheKey]string
+	// fileLocks the held file locks of the worktrees
+	fileLocks []*flock.Flock
+	symlinks  []string
+	// uriLocks serializes refreshes of the same repository, while allowing different repositories
+	// to be refreshed concurrently
+	uriLocks map[string]*sync.Mutex
+}
+
+type cacheKey struct {
+	uri string
+	ref Ref
+}
+
+// NewCachedCloner creates a cloner that keeps its clones in cacheDir. Safe for concurrent use.
+func NewCachedCloner(cacheDir string) Cloner {
+	return &cachedCloner{
+		cacheDir: cacheDir,
+		clones:   make(map[cacheKey]string),
+		uriLocks: make(map[string]*sync.Mutex),
+	}
+}
+
+var _ Cloner = &cachedCloner{}
+
+// Clone returns the clone of the repository at the given ref from the cache.
+// Clones it if it's not cached yet, or fetches the latest changes if it's the first time it's used in this run.
+func (c *cachedCloner) Clone(ctx context.Context, uri string, ref Ref, fixedClonePath string) (string, error) {
+	logger := log.FromContext(ctx)
+
+	unlock := c.lockURI(uri)
+	defer unlock()
+
+	key := cacheKey{uri: uri, ref: ref}
+	c.mu.Lock()
+	clonePath, ok := c.clones[key]
+	c.mu.Unlock()
+
+	if !ok {
+		var err error
+		if clonePath, err = c.refresh(ctx, uri, ref); err != nil {
+			return "", err
+		}
+
+		c.mu.Lock()
+		c.clones[key] = clonePath
+		c.mu.Unlock()
+	} else {
+		logger.Debugf("Found repository '%s' (ref '%s') in cache in directory '%s'", uri, ref, clonePath)
+	}
+
+	if fixedClonePath != "" {
+		if err := linkClonePath(clonePath, fixedClonePath); err != nil {
+			return "", err
+		}
+
+		c.mu.Lock()
+		c.symlinks = append(c.symlinks, fixedClonePath)
+		c.mu.Unlock()
+	}
+
+	return clonePath, nil
+}
+
+// refresh checks out the latest commit of the ref in a worktree of its entry that isn't in use by another run,
+// and keeps it locked. Returns the worktree.
+func (c *cachedCloner) refresh(ctx context.Context, uri string, ref Ref) (string, error) {
+	logger := log.FromContext(ctx)
+
+	repoDir := filepath.Join(c.cacheDir, cacheRepositoriesDir, dirName(uri))
+	entryDir := filepath.Join(repoDir, worktreesDirName, dirName(ref.String()))
+	if err := os.MkdirAll(entryDir, 0750); err != nil {
+		return "", errors.Wrapf(err, "Failed to create cache dir '%s'", entryDir)
+	}
+
+	entryLock := flock.New(entryDir + cacheLockSuffix)
+	if _, err := entryLock.TryRLockContext(ctx, cacheLockRetryDelay); err != nil {
+		return "", errors.Wrapf(err, "Failed to lock cache entry '%s'", entryDir)
+	}
+	defer func() { _ = entryLock.Unlock() }()
+
+	var cloneDir string
+	var fileLock *flock.Flock
+	for i := 0; fileLock == nil; i++ {
+		cloneDir = filepath.Join(entryDir, cacheCloneDir)
+		if i > 0 {
+			cloneDir += "-" + strconv.Itoa(i)
+		}
+
+		lock := flock.New(cloneDir + cacheLockSuffix)
+		locked, err := lock.TryLock()
+		if err != nil {
+			return "", errors.Wrapf(err, "Failed to lock cache worktree '%s'", cloneDir)
+		}
+		if locked {
+			fileLock = lock
+		} else {
+			logger.Debugf("Cache worktree '%s' is in use by another run", cloneDir)
+		}
+	}
+
+	if err := refreshEntry(ctx, repoDir, entryDir, cloneDir, uri, ref); err != nil {
+		_ = fileLock.Unlock()
+
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fileLocks = append(c.fileLocks, fileLock)
+
+	return cloneDir, nil
+}
+
+// refreshEntry fetches the ref into the store of the repository and checks it out in cloneDir, a worktree of
+// the entry. The worktree must be locked exclusively.
+func refreshEntry(ctx context.Context, repoDir, entryDir, cloneDir, uri string, ref Ref) error {
+	logger := log.FromContext(ctx)
+
+	storeLock := flock.New(filepath.Join(repoDir, storeDirName+".lock"))
+	if _, err := storeLock.TryLockContext(ctx, cacheLockRetryDelay); err != nil {
+		return errors.Wrapf(err, "Failed to lock the cache store of '%s'", uri)
+	}
+	defer func() { _ = storeLock.Unlock() }()
+
+	storeDir := filepath.Join(repoDir, storeDirName)
+	if !isStore(storeDir) {
+		logger.Infof("Cloning '%s'", uri)
+		if err := os.RemoveAll(storeDir); err != nil {
+			return errors.Wrapf(err, "Failed to remove cache store '%s'", storeDir)
+		}
+
+		if err := initStore(ctx, storeDir, uri); err != nil {
+			return err
+		}
+	} else {
+		logger.Infof("Fetching '%s'", uri)
+	}
+
+	commit, err := fetchRevision(ctx, storeDir, uri, ref)
+	if err != nil {
+		return err
+	}
+
+	if err := checkoutWorktree(ctx, storeDir, cloneDir, commit); err != nil {
+		return err
+	}
+
+	return writeCacheMetadata(entryDir, uri, ref)
+}
+
+// Close releases the cache entries. The clones are kept in the cache.
+func (c *cachedCloner) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, symlink := range c.symlinks {
+		_ = os.Remove(symlink)
+	}
+	c.symlinks = nil
+
+	for _, fileLock := range c.fileLocks {
+		_ = fileLock.Unlock()
+	}
+	c.fileLocks = nil
+	c.clones = make(map[cacheKey]string)
+}
+
+func (c *cachedCloner) lockURI(uri string) func() {
+	c.mu.Lock()
+	uriLock, ok := c.uriLocks[uri]
+	if !ok {
+		uriLock = &sync.Mutex{}
+		c.uriLocks[uri] = uriLock
+	}
+	c.mu.Unlock()
+
+	uriLock.Lock()
+
+	return uriLock.Unlock
+}
+
+func writeCacheMetadata(entryDir, uri string, ref Ref) error {
+	buf, err := yaml.Marshal(&CacheEntry{Repository: uri, Ref: ref.String(), LastUsed: time.Now().UTC()})
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal cache metadata")
+	}
+
+	path := filepath.Join(entryDir, cacheMetadataFilename)
+	if err := os.WriteFile(path, buf, 0600); err != nil {
+		return errors.Wrapf(err, "Failed to write cache metadata '%s'", path)
+	}
+
+	return nil
+}
+
+// ListCache returns the entries of the clone cache in cacheDir, sorted by repository and ref
+func ListCache(cacheDir string) ([]*CacheEntry, error) {
+	entryDirs, err := filepath.Glob(filepath.Join(cacheDir, cacheRepositoriesDir, "*", worktreesDirName, "*"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list cache dir '%s'", cacheDir)
+	}
+
+	entries := []*CacheEntry{}
+	for _, entryDir := range entryDirs {
+		if info, err := os.Stat(entryDir); err != nil || !info.IsDir() {
+			continue
+		}
+
+		entry := &CacheEntry{}
+		if err := utils.ReadYaml(filepath.Join(entryDir, cacheMetadataFilename), entry); err != nil {
+			// An entry that was interrupted while being cloned
+			entry.Repository = filepath.Base(filepath.Dir(filepath.Dir(entryDir)))
+		}
+		entry.Path = entryDir
+
+		if entry.Size, err = dirSize(entryDir); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Repository != entries[j].Repository {
+			return entries[i].Repository < entries[j].Repository
+		}
+
+		return entries[i].Ref < entries[j].Ref
+	})
+
+	return entries, nil
+}
+
+// PruneCache removes the entries of the clone cache in cacheDir that were last used before the given time.
+// The store of a repository is removed along with its last entry.
+// Entries that are in use by another process are skipped.
+// Returns the removed entries.
+func PruneCache(ctx context.Context, cacheDir string, before time.Time) ([]*CacheEntry, error) {
+	logger := log.FromContext(ctx)
+
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []*CacheEntry{}
+	for _, entry := range entries {
+		if !entry.LastUsed.Before(before) {
+			continue
+		}
+
+		unlock, locked, err := lockEntryForRemoval(entry.Path)
+		if err != nil {
+			return removed, err
+		}
+		if !locked {
+			logger.Warnf("Skipping cache entry of '%s' since it's in use", entry.Repository)
+
+			continue
+		}
+
+		err = removeEntry(ctx, entry.Path)
+		unlock()
+		if err != nil {
+			return removed, err
+		}
+
+		removed = append(removed, entry)
+	}
+
+	return removed, nil
+}
+
+// lockEntryForRemoval locks the entry and its worktrees exclusively, without waiting for them.
+// Returns false if the entry is being refreshed or in use, or else a function that unlocks it.
+func lockEntryForRemoval(entryDir string) (func(), bool, error) {
+	lockPaths, err := filepath.Glob(filepath.Join(entryDir, "*"+cacheLockSuffix))
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "Failed to list the locks of cache entry '%s'", entryDir)
+	}
+
+	fileLocks := []*flock.Flock{}
+	unlock := func() {
+		for _, fileLock := range fileLocks {
+			_ = fileLock.Unlock()
+		}
+	}
+
+	// The entry is locked first, so that no worktrees are added to it meanwhile
+	for _, lockPath := range append([]string{entryDir + cacheLockSuffix}, lockPaths...) {
+		fileLock := flock.New(lockPath)
+		locked, err := fileLock.TryLock()
+		if err != nil || !locked {
+			unlock()
+			if err != nil {
+				return nil, false, errors.Wrapf(err, "Failed to lock cache entry '%s'", entryDir)
+			}
+
+			return nil, false, nil
+		}
+		fileLocks = append(fileLocks, fileLock)
+	}
+
+	return unlock, true, nil
+}
+
+// removeEntry removes the entry, and the store of its repository if no other entries are left.
+// The entry must be locked for removal.
+func removeEntry(ctx context.Context, entryDir string) error {
+	repoDir := filepath.Dir(filepath.Dir(entryDir))
+	storeLock := flock.New(filepath.Join(repoDir, storeDirName+".lock"))
+	if _, err := storeLock.TryLockContext(ctx, cacheLockRetryDelay); err != nil {
+		return errors.Wrapf(err, "Failed to lock the cache store '%s'", repoDir)
+	}
+	defer func() { _ = storeLock.Unlock() }()
+
+	if err := os.RemoveAll(entryDir); err != nil {
+		return errors.Wrapf(err, "Failed to remove cache entry '%s'", entryDir)
+	}
+
+	remainingEntries, err := filepath.Glob(filepath.Join(repoDir, worktreesDirName, "*", cacheCloneDir+"*", ".git"))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to list cache entries of '%s'", repoDir)
+	}
+
+	storeDir := filepath.Join(repoDir, storeDirName)
+	if len(remainingEntries) == 0 {
+		if err := os.RemoveAll(storeDir); err != nil {
+			return errors.Wrapf(err, "Failed to remove cache store '%s'", storeDir)
+		}
+	} else if isStore(storeDir) {
+		if output, err := utils.NewCommandRunner(storeDir).Run(ctx, "git", "worktree", "prune"); err != nil {
+			return errors.Wrapf(err, "Failed to prune worktrees: %s", output)
+		}
+	}
+
+	return nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to compute the size of '%s'", dir)
+	}
+
+	return size, nil
+}
@@ -0,0 +1,169 @@
+package git_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg/cmd/testutils"
+	"github.com/ilaif/goplicate/pkg/git"
+)
+
+// createBareRepository creates a bare repository with a single file, and returns its uri
+// along with a working copy that can push to it
+func createBareRepository(t *testing.T, content string) (string, string) {
+	workDir := testutils.CreateGitRepository(t, map[string]string{"file.txt": content})
+	bareDir := filepath.Join(t.TempDir(), "origin.git")
+	testutils.RunGit(t, workDir, "clone", "--quiet", "--bare", workDir, bareDir)
+	testutils.RunGit(t, workDir, "remote", "add", "origin", bareDir)
+
+	return "file://" + bareDir, workDir
+}
+
+func requireCloneContent(r *require.Assertions, clonePath, content string) {
+	buf, err := os.ReadFile(filepath.Join(clonePath, "file.txt"))
+	r.NoError(err)
+	r.Equal(content, string(buf))
+}
+
+func TestCachedCloner_Refresh(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+
+	uri, workDir := createBareRepository(t, "v1")
+
+	cloner := git.NewCachedCloner(cacheDir)
+	clonePath, err := cloner.Clone(ctx, uri, git.Ref{}, "")
+	r.NoError(err)
+	requireCloneContent(r, clonePath, "v1")
+	r.NoError(os.WriteFile(filepath.Join(clonePath, "leftover.txt"), []byte("leftover"), 0600))
+	cloner.Close()
+
+	testutils.CommitGitFiles(t, workDir, map[string]string{"file.txt": "v2"})
+	testutils.RunGit(t, workDir, "push", "--quiet", "origin", "HEAD")
+
+	// A new run reuses the cached clone and fetches the latest commit
+	cloner = git.NewCachedCloner(cacheDir)
+	defer cloner.Close()
+	refreshedClonePath, err := cloner.Clone(ctx, uri, git.Ref{}, "")
+	r.NoError(err)
+	r.Equal(clonePath, refreshedClonePath)
+	requireCloneContent(r, clonePath, "v2")
+	r.NoFileExists(filepath.Join(clonePath, "leftover.txt"))
+
+	entries, err := git.ListCache(cacheDir)
+	r.NoError(err)
+	r.Len(entries, 1)
+	r.Equal(uri, entries[0].Repository)
+	r.Equal("", entries[0].Ref)
+	r.Positive(entries[0].Size)
+	r.WithinDuration(time.Now(), entries[0].LastUsed, time.Minute)
+}
+
+func TestCachedCloner_Refs(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	uri, workDir := createBareRepository(t, "default")
+	firstCommit := testutils.RunGit(t, workDir, "rev-parse", "HEAD")[:40]
+	testutils.RunGit(t, workDir, "checkout", "--quiet", "-b", "feature")
+	testutils.CommitGitFiles(t, workDir, map[string]string{"file.txt": "feature"})
+	testutils.RunGit(t, workDir, "push", "--quiet", "origin", "feature")
+
+	cloner := git.NewCachedCloner(t.TempDir())
+	defer cloner.Close()
+
+	featureClonePath, err := cloner.Clone(ctx, uri, git.Ref{Branch: "feature"}, "")
+	r.NoError(err)
+	requireCloneContent(r, featureClonePath, "feature")
+
+	defaultClonePath, err := cloner.Clone(ctx, uri, git.Ref{}, "")
+	r.NoError(err)
+	r.NotEqual(featureClonePath, defaultClonePath)
+	requireCloneContent(r, defaultClonePath, "default")
+
+	commitClonePath, err := cloner.Clone(ctx, uri, git.Ref{Commit: firstCommit}, "")
+	r.NoError(err)
+	requireCloneContent(r, commitClonePath, "default")
+
+	// All refs are worktrees of a single object store
+	worktrees := testutils.RunGit(t, featureClonePath, "worktree", "list")
+	r.Contains(worktrees, featureClonePath)
+	r.Contains(worktrees, defaultClonePath)
+	r.Contains(worktrees, commitClonePath)
+}
+
+func TestCachedCloner_SharedBetweenProcesses(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+
+	uri, workDir := createBareRepository(t, "v1")
+
+	cloner := git.NewCachedCloner(cacheDir)
+	defer cloner.Close()
+	clonePath, err := cloner.Clone(ctx, uri, git.Ref{}, "")
+	r.NoError(err)
+
+	testutils.CommitGitFiles(t, workDir, map[string]string{"file.txt": "v2"})
+	testutils.RunGit(t, workDir, "push", "--quiet", "origin", "HEAD")
+
+	// Another cloner (i.e. another process) refreshes the entry in a worktree of its own while it's in use,
+	// without waiting and without changing the worktree that is in use
+	otherCloner := git.NewCachedCloner(cacheDir)
+	defer otherCloner.Close()
+	otherClonePath, err := otherCloner.Clone(ctx, uri, git.Ref{}, "")
+	r.NoError(err)
+	r.NotEqual(clonePath, otherClonePath)
+	requireCloneContent(r, otherClonePath, "v2")
+	requireCloneContent(r, clonePath, "v1")
+
+	// The entry isn't pruned until both cloners are done with it
+	removed, err := git.PruneCache(ctx, cacheDir, time.Now())
+	r.NoError(err)
+	r.Empty(removed)
+
+	cloner.Close()
+	otherCloner.Close()
+	removed, err = git.PruneCache(ctx, cacheDir, time.Now())
+	r.NoError(err)
+	r.Len(removed, 1)
+}
+
+func TestPruneCache(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+
+	uri, _ := createBareRepository(t, "v1")
+	inUseURI, _ := createBareRepository(t, "v1")
+
+	cloner := git.NewCachedCloner(cacheDir)
+	_, err := cloner.Clone(ctx, uri, git.Ref{}, "")
+	r.NoError(err)
+	cloner.Close()
+
+	inUseCloner := git.NewCachedCloner(cacheDir)
+	defer inUseCloner.Close()
+	_, err = inUseCloner.Clone(ctx, inUseURI, git.Ref{}, "")
+	r.NoError(err)
+
+	removed, err := git.PruneCache(ctx, cacheDir, time.Now().Add(-time.Hour))
+	r.NoError(err)
+	r.Empty(removed)
+
+	removed, err = git.PruneCache(ctx, cacheDir, time.Now())
+	r.NoError(err)
+	r.Len(removed, 1)
+	r.Equal(uri, removed[0].Repository)
+
+	entries, err := git.ListCache(cacheDir)
+	r.NoError(err)
+	r.Len(entries, 1)
+	r.Equal(inUseURI, entries[0].Repository)
+}
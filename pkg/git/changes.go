@@ -0,0 +1,181 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+const (
+	defaultBranch        = "chore/update-goplicate-snippets"
+	defaultCommitMessage = "chore: update goplicate snippets"
+	defaultBody          = "# Update goplicate snippets"
+)
+
+// ChangeSet describes the changes that are published.
+// It is also the data that the branch, commit message, title and body templates are rendered with.
+type ChangeSet struct {
+	// Targets the updated targets
+	Targets []*ChangedTarget
+	// Files other files that were updated along with the targets (e.g. the lock file)
+	Files []string
+	// Hooks the outputs of the post hooks that ran after updating the targets
+	Hooks []*HookOutput
+}
+
+// ChangedTarget an updated target
+type ChangedTarget struct {
+	// Path the path of the target file, relative to the project directory
+	Path string
+	// Source a human-readable description of the target's source
+	Source string
+	// SourceRepository the repository of the source, or empty if it's a local path
+	SourceRepository string
+	// SourceRef the tag or branch of the source repository, or empty for the default branch
+	SourceRef string
+	// SourceCommit the commit SHA of the source repository that the target was synced from
+	SourceCommit string
+	// SourcePath the path of the source file
+	SourcePath string
+	// Blocks the updated blocks
+	Blocks []*ChangedBlock
+}
+
+// ChangedBlock an updated block of a target
+type ChangedBlock struct {
+	Name string
+	// Diff a unified diff of the block update
+	Diff string
+}
+
+// HookOutput the output of a post hook
+type HookOutput struct {
+	Command string
+	Output  string
+}
+
+// TargetPaths returns the paths of all updated targets
+func (c *ChangeSet) TargetPaths() []string {
+	return lo.Map(c.Targets, func(target *ChangedTarget, _ int) string { return target.Path })
+}
+
+// BlockNames returns the unique names of all updated blocks
+func (c *ChangeSet) BlockNames() []string {
+	names := []string{}
+	for _, target := range c.Targets {
+		for _, block := range target.Blocks {
+			names = append(names, block.Name)
+		}
+	}
+
+	return lo.Uniq(names)
+}
+
+// SourceRepositories returns the unique repositories that the updated targets were synced from
+func (c *ChangeSet) SourceRepositories() []string {
+	repositories := []string{}
+	for _, target := range c.Targets {
+		if target.SourceRepository != "" {
+			repositories = append(repositories, target.SourceRepository)
+		}
+	}
+
+	return lo.Uniq(repositories)
+}
+
+// Markdown returns a change request description with a section per updated target and block, including
+// collapsible diffs, the source each target was synced from and the output of the post hooks
+func (c *ChangeSet) Markdown() string {
+	return c.markdown(defaultBody)
+}
+
+// markdown returns the change request description of Markdown under the given heading
+func (c *ChangeSet) markdown(heading string) string {
+	var sb strings.Builder
+	sb.WriteString(heading + "\n")
+
+	for _, target := range c.Targets {
+		sb.WriteString(fmt.Sprintf("\n## `%s`\n\n", target.Path))
+		sb.WriteString(fmt.Sprintf("Synced from %s\n", target.sourceMarkdown()))
+
+		for _, block := range target.Blocks {
+			sb.WriteString(fmt.Sprintf("\n### Block `%s`\n\n", block.Name))
+			sb.WriteString(collapsibleCodeBlock("Diff", "diff", block.Diff))
+		}
+	}
+
+	if len(c.Hooks) > 0 {
+		sb.WriteString("\n## Post hooks\n")
+		for _, hook := range c.Hooks {
+			sb.WriteString("\n")
+			sb.WriteString(collapsibleCodeBlock(fmt.Sprintf("<code>%s</code>", html.EscapeString(hook.Command)), "",
+				hook.Output))
+		}
+	}
+
+	return strings.TrimSpace(sb.String())
+}
+
+// only returns the changes of the given paths
+func (c *ChangeSet) only(paths []string) *ChangeSet {
+	return &ChangeSet{
+		Targets: lo.Filter(c.Targets, func(target *ChangedTarget, _ int) bool {
+			return lo.Contains(paths, target.Path)
+		}),
+		Files: lo.Intersect(c.Files, paths),
+		Hooks: c.Hooks,
+	}
+}
+
+// sourceMarkdown describes the source of the target, including the exact commit
+func (t *ChangedTarget) sourceMarkdown() string {
+	if t.SourceRepository == "" {
+		return fmt.Sprintf("`%s`", t.SourcePath)
+	}
+
+	source := fmt.Sprintf("`%s` in %s", t.SourcePath, t.SourceRepository)
+	if t.SourceRef != "" {
+		source += fmt.Sprintf(" (`%s`)", t.SourceRef)
+	}
+	if t.SourceCommit != "" {
+		source += fmt.Sprintf(" at commit `%s`", t.SourceCommit)
+	}
+
+	return source
+}
+
+// collapsibleCodeBlock returns a collapsed markdown code block with the given summary
+func collapsibleCodeBlock(summary, lang, code string) string {
+	// Use a fence that is longer than any backtick sequence inside the code
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+
+	return fmt.Sprintf("<details>\n<summary>%s</summary>\n\n%s%s\n%s\n%s\n\n</details>\n",
+		summary, fence, lang, strings.TrimRight(code, "\n"), fence)
+}
+
+// render renders the template text with the change set, or returns defaultText if text is empty
+func (c *ChangeSet) render(name, text, defaultText string) (string, error) {
+	if text == "" {
+		return defaultText, nil
+	}
+
+	tpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to parse the %s template", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, c); err != nil {
+		return "", errors.Wrapf(err, "Failed to render the %s template", name)
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
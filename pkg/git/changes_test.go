@@ -0,0 +1,80 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg/git"
+)
+
+func TestChangeSet_Markdown(t *testing.T) {
+	r := require.New(t)
+
+	changeSet := &git.ChangeSet{
+		Targets: []*git.ChangedTarget{
+			{
+				Path:             ".eslintrc.js",
+				SourceRepository: "https://github.com/org/shared",
+				SourceRef:        "v1",
+				SourceCommit:     "0123456789abcdef0123456789abcdef01234567",
+				SourcePath:       "eslint/.eslintrc.js",
+				Blocks: []*git.ChangedBlock{
+					{Name: "rules", Diff: "@@ -1 +1 @@\n-indent: 4\n+indent: 2\n"},
+				},
+			},
+			{
+				Path:       "README.md",
+				SourcePath: "../shared/README.md",
+				Blocks:     []*git.ChangedBlock{{Name: "badges", Diff: "+```\n"}},
+			},
+		},
+		Hooks: []*git.HookOutput{{Command: "npm run lint && echo ok", Output: "ok\n"}},
+	}
+
+	r.Equal(`# Update goplicate snippets
+
+## `+"`.eslintrc.js`"+`
+
+Synced from `+"`eslint/.eslintrc.js`"+` in https://github.com/org/shared (`+"`v1`"+`) at commit `+
+		"`0123456789abcdef0123456789abcdef01234567`"+`
+
+### Block `+"`rules`"+`
+
+<details>
+<summary>Diff</summary>
+
+`+"```diff"+`
+@@ -1 +1 @@
+-indent: 4
++indent: 2
+`+"```"+`
+
+</details>
+
+## `+"`README.md`"+`
+
+Synced from `+"`../shared/README.md`"+`
+
+### Block `+"`badges`"+`
+
+<details>
+<summary>Diff</summary>
+
+`+"````diff"+`
++`+"```"+`
+`+"````"+`
+
+</details>
+
+## Post hooks
+
+<details>
+<summary><code>npm run lint &amp;&amp; echo ok</code></summary>
+
+`+"```"+`
+ok
+`+"```"+`
+
+</details>`, changeSet.Markdown())
+}
@@ -3,95 +3,183 @@ package git
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sync"
 
 	"github.com/caarlos0/log"
 	"github.com/pkg/errors"
-
-	"github.com/ilaif/goplicate/pkg/utils"
 )
 
 type Cloner interface {
 	Clone(
 		ctx context.Context,
-		uri, branch, fixedClonePath string,
+		uri string,
+		ref Ref,
+		fixedClonePath string,
 	) (clonePath string, err error)
 	Close()
 }
 
+// Ref a revision of a repository to check out. The zero value refers to the default branch.
+type Ref struct {
+	// Branch a branch or a tag
+	Branch string
+	// Commit a commit SHA. Takes precedence over Branch.
+	Commit string
+}
+
+func (r Ref) String() string {
+	if r.Commit != "" {
+		return r.Commit
+	}
+
+	return r.Branch
+}
+
+const (
+	storeDirName     = "store"
+	worktreesDirName = "worktrees"
+)
+
 var (
 	validPathRegexp = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
 )
 
-// Cloner manages cloned git repositories
+// cloner manages cloned git repositories in temporary directories. Safe for concurrent use.
+// Every repository is fetched once into a store, and every ref of it is checked out in its own worktree.
 type cloner struct {
-	repositories map[string]string
+	mu           sync.Mutex
+	repositories map[string]*clonedRepository
+	symlinks     []string
+	// uriLocks serializes clones of the same repository, while allowing different repositories
+	// to be cloned concurrently
+	uriLocks map[string]*sync.Mutex
+}
+
+// clonedRepository a repository that was cloned into a temporary directory
+type clonedRepository struct {
+	dir string
+	// worktrees the worktree directories by ref
+	worktrees map[Ref]string
 }
 
 func NewCloner() Cloner {
 	return &cloner{
-		repositories: make(map[string]string),
+		repositories: make(map[string]*clonedRepository),
+		uriLocks:     make(map[string]*sync.Mutex),
 	}
 }
 
 var _ Cloner = &cloner{}
 
-// Clone clones the repository into a temporary dir and returns it.
-// Caches to avoid cloning the same repository twice.
+// Clone clones the repository at the given ref into a temporary dir and returns it.
+// Caches to avoid cloning the same repository ref twice, and fetches other refs of the same repository
+// into the existing clone.
 func (c *cloner) Clone(
 	ctx context.Context,
-	uri, branch, fixedClonePath string,
+	uri string,
+	ref Ref,
+	fixedClonePath string,
 ) (string, error) {
-	if tempdir, ok := c.repositories[uri]; ok {
-		log.Debugf("Found repository '%s' in cache in directory '%s'", uri, tempdir)
-
-		// If there's a clone path and its different from an existing one in
-		// the same directory, then we want to symlink to be able to reference it
-		if fixedClonePath != "" && tempdir != fixedClonePath {
-			if err := os.Symlink(tempdir, fixedClonePath); err != nil {
-				return "", errors.Wrapf(err, "Failed to create symlink '%s' for '%s'", tempdir, fixedClonePath)
-			}
-		}
+	logger := log.FromContext(ctx)
 
-		return tempdir, nil
-	}
+	unlock := c.lockURI(uri)
+	defer unlock()
 
-	dirPattern := validPathRegexp.ReplaceAllString("_goplicate_"+uri, "_")
+	repo, err := c.getOrInitRepository(ctx, uri)
+	if err != nil {
+		return "", err
+	}
 
-	var err error
-	tempdir := fixedClonePath
-	if tempdir != "" {
-		if err := os.MkdirAll(tempdir, 0750); err != nil {
-			return "", errors.Wrapf(err, "Failed to create dir '%s'", tempdir)
-		}
+	worktreeDir, ok := repo.worktrees[ref]
+	if ok {
+		logger.Debugf("Found repository '%s' (ref '%s') in cache in directory '%s'", uri, ref, worktreeDir)
 	} else {
-		tempdir, err = os.MkdirTemp(os.TempDir(), dirPattern)
+		logger.Infof("Cloning '%s'", uri)
+
+		storeDir := filepath.Join(repo.dir, storeDirName)
+		commit, err := fetchRevision(ctx, storeDir, uri, ref)
 		if err != nil {
-			return "", errors.Wrapf(err, "Failed to create tempdir '%s'", dirPattern)
+			return "", err
+		}
+
+		worktreeDir = filepath.Join(repo.dir, worktreesDirName, dirName(ref.String()))
+		if err := checkoutWorktree(ctx, storeDir, worktreeDir, commit); err != nil {
+			return "", err
 		}
+		repo.worktrees[ref] = worktreeDir
 	}
 
-	cmdRunner := utils.NewCommandRunner(tempdir)
+	// If there's a clone path, symlink it to be able to reference the clone
+	if fixedClonePath != "" && worktreeDir != fixedClonePath {
+		if err := linkClonePath(worktreeDir, fixedClonePath); err != nil {
+			return "", err
+		}
+
+		c.mu.Lock()
+		c.symlinks = append(c.symlinks, fixedClonePath)
+		c.mu.Unlock()
+	}
+
+	return worktreeDir, nil
+}
 
-	args := []string{"clone", "--depth", "1", uri, "."}
-	if branch != "" {
-		args = append(args, "--branch", branch)
+// getOrInitRepository returns the cloned repository, and initializes its store if it's not cloned yet.
+// Must be called while holding the uri lock.
+func (c *cloner) getOrInitRepository(ctx context.Context, uri string) (*clonedRepository, error) {
+	c.mu.Lock()
+	repo, ok := c.repositories[uri]
+	c.mu.Unlock()
+	if ok {
+		return repo, nil
 	}
 
-	log.Infof("Cloning '%s'", uri)
+	dirPattern := validPathRegexp.ReplaceAllString("_goplicate_"+uri, "_")
+	tempdir, err := os.MkdirTemp(os.TempDir(), dirPattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create tempdir '%s'", dirPattern)
+	}
+
+	if err := initStore(ctx, filepath.Join(tempdir, storeDirName), uri); err != nil {
+		_ = os.RemoveAll(tempdir)
 
-	if output, err := cmdRunner.Run(ctx, "git", args...); err != nil {
-		return "", errors.Wrapf(err, "Failed to clone repository '%s': %s", uri, output)
+		return nil, err
 	}
 
-	c.repositories[uri] = tempdir
+	repo = &clonedRepository{dir: tempdir, worktrees: map[Ref]string{}}
+	c.mu.Lock()
+	c.repositories[uri] = repo
+	c.mu.Unlock()
 
-	return tempdir, nil
+	return repo, nil
 }
 
 func (c *cloner) Close() {
-	for uri, tempdir := range c.repositories {
-		_ = os.RemoveAll(tempdir)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, symlink := range c.symlinks {
+		_ = os.Remove(symlink)
+	}
+	c.symlinks = nil
+
+	for uri, repo := range c.repositories {
+		_ = os.RemoveAll(repo.dir)
 		delete(c.repositories, uri)
 	}
 }
+
+func (c *cloner) lockURI(uri string) func() {
+	c.mu.Lock()
+	uriLock, ok := c.uriLocks[uri]
+	if !ok {
+		uriLock = &sync.Mutex{}
+		c.uriLocks[uri] = uriLock
+	}
+	c.mu.Unlock()
+
+	uriLock.Lock()
+
+	return uriLock.Unlock
+}
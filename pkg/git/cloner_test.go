@@ -0,0 +1,102 @@
+package git_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg/cmd/testutils"
+	"github.com/ilaif/goplicate/pkg/git"
+)
+
+func TestCloner_Refs(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	repoDir := testutils.CreateGitRepository(t, map[string]string{"file.txt": "v1"})
+	firstCommit := testutils.RunGit(t, repoDir, "rev-parse", "HEAD")[:40]
+	testutils.RunGit(t, repoDir, "tag", "v1")
+	testutils.CommitGitFiles(t, repoDir, map[string]string{"file.txt": "v2"})
+	uri := "file://" + repoDir
+
+	cloner := git.NewCloner()
+
+	latestClonePath, err := cloner.Clone(ctx, uri, git.Ref{}, "")
+	r.NoError(err)
+	requireCloneContent(r, latestClonePath, "v2")
+
+	tagClonePath, err := cloner.Clone(ctx, uri, git.Ref{Branch: "v1"}, "")
+	r.NoError(err)
+	requireCloneContent(r, tagClonePath, "v1")
+
+	commitClonePath, err := cloner.Clone(ctx, uri, git.Ref{Commit: firstCommit}, "")
+	r.NoError(err)
+	requireCloneContent(r, commitClonePath, "v1")
+
+	// The same ref is cloned once
+	cachedClonePath, err := cloner.Clone(ctx, uri, git.Ref{}, "")
+	r.NoError(err)
+	r.Equal(latestClonePath, cachedClonePath)
+	requireCloneContent(r, latestClonePath, "v2")
+
+	// All refs are worktrees of a single object store
+	r.Equal(filepath.Dir(latestClonePath), filepath.Dir(tagClonePath))
+	r.Equal(filepath.Dir(latestClonePath), filepath.Dir(commitClonePath))
+	r.Equal(firstCommit, testutils.RunGit(t, commitClonePath, "rev-parse", "HEAD")[:40])
+	worktrees := testutils.RunGit(t, latestClonePath, "worktree", "list")
+	r.Contains(worktrees, latestClonePath)
+	r.Contains(worktrees, tagClonePath)
+
+	cloner.Close()
+	r.NoDirExists(latestClonePath)
+}
+
+func TestCloner_FixedClonePath(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	repoDir := testutils.CreateGitRepository(t, map[string]string{"file.txt": "v1"})
+	fixedClonePath := filepath.Join(t.TempDir(), "shared")
+
+	cloner := git.NewCloner()
+	_, err := cloner.Clone(ctx, "file://"+repoDir, git.Ref{}, fixedClonePath)
+	r.NoError(err)
+	requireCloneContent(r, fixedClonePath, "v1")
+
+	cloner.Close()
+	_, err = os.Lstat(fixedClonePath)
+	r.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestCloner_FixedClonePathOfEarlierVersions(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	repoDir := testutils.CreateGitRepository(t, map[string]string{"file.txt": "v1"})
+	fixedClonePath := filepath.Join(t.TempDir(), "shared")
+
+	// Earlier versions cloned into the clone path itself
+	testutils.RunGit(t, repoDir, "clone", "--quiet", repoDir, fixedClonePath)
+	testutils.CommitGitFiles(t, repoDir, map[string]string{"file.txt": "v2"})
+
+	cloner := git.NewCloner()
+	defer cloner.Close()
+	_, err := cloner.Clone(ctx, "file://"+repoDir, git.Ref{}, fixedClonePath)
+	r.NoError(err)
+	requireCloneContent(r, fixedClonePath, "v2")
+
+	info, err := os.Lstat(fixedClonePath)
+	r.NoError(err)
+	r.NotZero(info.Mode() & os.ModeSymlink)
+
+	// A directory that isn't a clone is kept
+	otherPath := filepath.Join(t.TempDir(), "other")
+	r.NoError(os.MkdirAll(otherPath, 0750))
+	r.NoError(os.WriteFile(filepath.Join(otherPath, "file.txt"), []byte("mine"), 0600))
+	_, err = cloner.Clone(ctx, "file://"+repoDir, git.Ref{}, otherPath)
+	r.ErrorContains(err, "already exists and is not a clone")
+	requireCloneContent(r, otherPath, "mine")
+}
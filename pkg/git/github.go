@@ -0,0 +1,218 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+const (
+	// GitHubTokenEnv the environment variable that holds the GitHub API token
+	GitHubTokenEnv = "GITHUB_TOKEN"
+
+	gitHubHost          = "github.com"
+	gitHubDefaultAPIURL = "https://api.github.com"
+	gitHubAPIVersion    = "2022-11-28"
+)
+
+// gitHubAPIURL returns the REST API URL of github.com, or of a GitHub Enterprise server
+// at baseURL (if specified) or at host
+func gitHubAPIURL(baseURL, host string) string {
+	if baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/") + "/api/v3"
+	}
+
+	if host == gitHubHost {
+		return gitHubDefaultAPIURL
+	}
+
+	return fmt.Sprintf("https://%s/api/v3", host)
+}
+
+// gitHubAPIProvider opens GitHub pull requests using the GitHub REST API
+type gitHubAPIProvider struct {
+	apiURL     string
+	token      string
+	repoPath   string
+	httpClient *http.Client
+}
+
+// NewGitHubAPIProvider creates a provider that uses the GitHub REST API at apiURL (e.g. https://api.github.com)
+// to open pull requests on the repository at repoPath (e.g. `owner/repo`).
+// Uses http.DefaultClient if httpClient is nil.
+func NewGitHubAPIProvider(apiURL, token, repoPath string, httpClient *http.Client) ChangeRequestProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &gitHubAPIProvider{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		token:      token,
+		repoPath:   repoPath,
+		httpClient: httpClient,
+	}
+}
+
+type gitHubPullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+}
+
+type gitHubRepository struct {
+	DefaultBranch string `json:"default_branch"`
+}
+
+// CreateChangeRequest opens a pull request, or returns the existing one and updates its title and body
+// if opts.UpdateExisting is set. Labels, reviewers and assignees are added in both cases.
+func (g *gitHubAPIProvider) CreateChangeRequest(ctx context.Context, opts ChangeRequestOpts) (*ChangeRequest, error) {
+	pr, err := g.findOpenPullRequest(ctx, opts.Head)
+	if err != nil {
+		return nil, err
+	}
+
+	changeRequest := &ChangeRequest{AlreadyExists: pr != nil}
+	if pr != nil && opts.UpdateExisting {
+		resource := fmt.Sprintf("/pulls/%d", pr.Number)
+		if _, err := g.do(ctx, http.MethodPatch, resource, map[string]string{
+			"title": opts.Title,
+			"body":  opts.Body,
+		}, pr); err != nil {
+			return nil, errors.Wrapf(err, "Failed to update pull request #%d", pr.Number)
+		}
+	} else if pr == nil {
+		base := opts.Base
+		if base == "" {
+			repo := &gitHubRepository{}
+			if _, err := g.do(ctx, http.MethodGet, "", nil, repo); err != nil {
+				return nil, errors.Wrap(err, "Failed to get the repository's default branch")
+			}
+			base = repo.DefaultBranch
+		}
+
+		pr = &gitHubPullRequest{}
+		if _, err := g.do(ctx, http.MethodPost, "/pulls", map[string]string{
+			"title": opts.Title,
+			"body":  opts.Body,
+			"head":  opts.Head,
+			"base":  base,
+		}, pr); err != nil {
+			return nil, errors.Wrap(err, "Failed to create a pull request")
+		}
+	}
+
+	changeRequest.Number = pr.Number
+	changeRequest.URL = pr.HTMLURL
+
+	if len(opts.Labels) > 0 {
+		resource := fmt.Sprintf("/issues/%d/labels", pr.Number)
+		body := map[string][]string{"labels": opts.Labels}
+		if _, err := g.do(ctx, http.MethodPost, resource, body, nil); err != nil {
+			return nil, errors.Wrap(err, "Failed to add labels")
+		}
+	}
+
+	if len(opts.Reviewers) > 0 {
+		resource := fmt.Sprintf("/pulls/%d/requested_reviewers", pr.Number)
+		body := map[string][]string{"reviewers": opts.Reviewers}
+		if _, err := g.do(ctx, http.MethodPost, resource, body, nil); err != nil {
+			return nil, errors.Wrap(err, "Failed to request reviewers")
+		}
+	}
+
+	if len(opts.Assignees) > 0 {
+		resource := fmt.Sprintf("/issues/%d/assignees", pr.Number)
+		body := map[string][]string{"assignees": opts.Assignees}
+		if _, err := g.do(ctx, http.MethodPost, resource, body, nil); err != nil {
+			return nil, errors.Wrap(err, "Failed to add assignees")
+		}
+	}
+
+	return changeRequest, nil
+}
+
+// findOpenPullRequest returns the open pull request of the given head branch, or nil if there isn't one
+func (g *gitHubAPIProvider) findOpenPullRequest(ctx context.Context, head string) (*gitHubPullRequest, error) {
+	owner := strings.SplitN(g.repoPath, "/", 2)[0]
+	query := url.Values{"head": {owner + ":" + head}, "state": {"open"}}
+	prs := []*gitHubPullRequest{}
+	if _, err := g.do(ctx, http.MethodGet, "/pulls?"+query.Encode(), nil, &prs); err != nil {
+		return nil, errors.Wrap(err, "Failed to list pull requests")
+	}
+
+	if len(prs) == 0 {
+		return nil, nil
+	}
+
+	return prs[0], nil
+}
+
+// do performs a request on the repository API resource and decodes the JSON response into out
+func (g *gitHubAPIProvider) do(ctx context.Context, method, resource string, body, out interface{}) (int, error) {
+	reqURL := fmt.Sprintf("%s/repos/%s%s", g.apiURL, g.repoPath, resource)
+
+	return doJSONRequest(ctx, g.httpClient, method, reqURL, map[string]string{
+		"Authorization":        "Bearer " + g.token,
+		"Accept":               "application/vnd.github+json",
+		"X-GitHub-Api-Version": gitHubAPIVersion,
+	}, body, out)
+}
+
+// gitHubCLIProvider opens GitHub pull requests using the GitHub CLI (`gh`)
+type gitHubCLIProvider struct {
+	cmdRunner *utils.CommandRunner
+}
+
+func NewGitHubCLIProvider(cmdRunner *utils.CommandRunner) ChangeRequestProvider {
+	return &gitHubCLIProvider{cmdRunner: cmdRunner}
+}
+
+func (g *gitHubCLIProvider) CreateChangeRequest(ctx context.Context, opts ChangeRequestOpts) (*ChangeRequest, error) {
+	args := []string{"pr", "create", "--title", opts.Title, "--body", opts.Body, "--head", opts.Head}
+	if opts.Base != "" {
+		args = append(args, "--base", opts.Base)
+	}
+	args = append(args, cliListArgs("--label", opts.Labels)...)
+	args = append(args, cliListArgs("--reviewer", opts.Reviewers)...)
+	args = append(args, cliListArgs("--assignee", opts.Assignees)...)
+
+	resp, err := g.cmdRunner.Run(ctx, "gh", args...)
+	resp = strings.TrimSuffix(resp, "\n")
+	alreadyExists := strings.Contains(resp, "already exists:")
+	if err != nil && !alreadyExists {
+		return nil, errors.Wrapf(err, "Failed to create a PR: %s", resp)
+	}
+
+	if alreadyExists {
+		prURL := strings.TrimSpace(resp[strings.LastIndex(resp, "already exists:")+len("already exists:"):])
+
+		if opts.UpdateExisting {
+			editArgs := []string{"pr", "edit", prURL, "--title", opts.Title, "--body", opts.Body}
+			editArgs = append(editArgs, cliListArgs("--add-label", opts.Labels)...)
+			editArgs = append(editArgs, cliListArgs("--add-reviewer", opts.Reviewers)...)
+			editArgs = append(editArgs, cliListArgs("--add-assignee", opts.Assignees)...)
+			if output, err := g.cmdRunner.Run(ctx, "gh", editArgs...); err != nil {
+				return nil, errors.Wrapf(err, "Failed to update PR '%s': %s", prURL, output)
+			}
+		}
+
+		return &ChangeRequest{URL: prURL, AlreadyExists: true}, nil
+	}
+
+	return &ChangeRequest{URL: resp}, nil
+}
+
+// cliListArgs repeats flag for every value (e.g. `--label a --label b`)
+func cliListArgs(flag string, values []string) []string {
+	args := []string{}
+	for _, value := range values {
+		args = append(args, flag, value)
+	}
+
+	return args
+}
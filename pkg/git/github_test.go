@@ -0,0 +1,142 @@
+package git_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg/git"
+)
+
+type gitHubTestServer struct {
+	*httptest.Server
+	requests []string
+	bodies   map[string]map[string]interface{}
+}
+
+func newGitHubTestServer(t *testing.T, prExists bool) *gitHubTestServer {
+	r := require.New(t)
+
+	server := &gitHubTestServer{bodies: map[string]map[string]interface{}{}}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.Equal("Bearer token", req.Header.Get("Authorization"))
+
+		endpoint := req.Method + " " + req.URL.Path
+		server.requests = append(server.requests, endpoint)
+		if req.Method != http.MethodGet {
+			body := map[string]interface{}{}
+			r.NoError(json.NewDecoder(req.Body).Decode(&body))
+			server.bodies[endpoint] = body
+		}
+
+		switch endpoint {
+		case "GET /api/v3/repos/owner/repo/pulls":
+			r.Equal("owner:chore/update-goplicate-snippets", req.URL.Query().Get("head"))
+			r.Equal("open", req.URL.Query().Get("state"))
+			if prExists {
+				_, _ = w.Write([]byte(`[{"number": 7, "html_url": "https://github.example.com/owner/repo/pull/7"}]`))
+			} else {
+				_, _ = w.Write([]byte(`[]`))
+			}
+		case "GET /api/v3/repos/owner/repo":
+			_, _ = w.Write([]byte(`{"default_branch": "main"}`))
+		case "POST /api/v3/repos/owner/repo/pulls":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"number": 8, "html_url": "https://github.example.com/owner/repo/pull/8"}`))
+		case "PATCH /api/v3/repos/owner/repo/pulls/7":
+			_, _ = w.Write([]byte(`{"number": 7, "html_url": "https://github.example.com/owner/repo/pull/7"}`))
+		case "POST /api/v3/repos/owner/repo/issues/7/labels",
+			"POST /api/v3/repos/owner/repo/issues/8/labels",
+			"POST /api/v3/repos/owner/repo/pulls/8/requested_reviewers",
+			"POST /api/v3/repos/owner/repo/issues/8/assignees":
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return server
+}
+
+func TestGitHubAPIProvider_Create(t *testing.T) {
+	r := require.New(t)
+
+	server := newGitHubTestServer(t, false)
+	defer server.Close()
+
+	provider := git.NewGitHubAPIProvider(server.URL+"/api/v3", "token", "owner/repo", server.Client())
+	pr, err := provider.CreateChangeRequest(context.TODO(), git.ChangeRequestOpts{
+		Title:     "chore: update goplicate snippets",
+		Body:      "# Update goplicate snippets",
+		Head:      "chore/update-goplicate-snippets",
+		Labels:    []string{"goplicate"},
+		Reviewers: []string{"reviewer"},
+		Assignees: []string{"assignee"},
+	})
+	r.NoError(err)
+	r.Equal(&git.ChangeRequest{Number: 8, URL: "https://github.example.com/owner/repo/pull/8"}, pr)
+
+	r.Equal(map[string]interface{}{
+		"title": "chore: update goplicate snippets",
+		"body":  "# Update goplicate snippets",
+		"head":  "chore/update-goplicate-snippets",
+		"base":  "main",
+	}, server.bodies["POST /api/v3/repos/owner/repo/pulls"])
+	r.Equal([]interface{}{"goplicate"}, server.bodies["POST /api/v3/repos/owner/repo/issues/8/labels"]["labels"])
+	r.Equal([]interface{}{"reviewer"},
+		server.bodies["POST /api/v3/repos/owner/repo/pulls/8/requested_reviewers"]["reviewers"])
+	r.Equal([]interface{}{"assignee"}, server.bodies["POST /api/v3/repos/owner/repo/issues/8/assignees"]["assignees"])
+}
+
+func TestGitHubAPIProvider_UpdateExisting(t *testing.T) {
+	r := require.New(t)
+
+	server := newGitHubTestServer(t, true)
+	defer server.Close()
+
+	provider := git.NewGitHubAPIProvider(server.URL+"/api/v3", "token", "owner/repo", server.Client())
+	pr, err := provider.CreateChangeRequest(context.TODO(), git.ChangeRequestOpts{
+		Title:          "chore: update goplicate snippets",
+		Body:           "# Updated body",
+		Head:           "chore/update-goplicate-snippets",
+		Base:           "main",
+		Labels:         []string{"goplicate"},
+		UpdateExisting: true,
+	})
+	r.NoError(err)
+	r.Equal(&git.ChangeRequest{Number: 7, URL: "https://github.example.com/owner/repo/pull/7", AlreadyExists: true}, pr)
+
+	r.Equal([]string{
+		"GET /api/v3/repos/owner/repo/pulls",
+		"PATCH /api/v3/repos/owner/repo/pulls/7",
+		"POST /api/v3/repos/owner/repo/issues/7/labels",
+	}, server.requests)
+	r.Equal("# Updated body", server.bodies["PATCH /api/v3/repos/owner/repo/pulls/7"]["body"])
+}
+
+func TestGitHubAPIProvider_AlreadyExists(t *testing.T) {
+	r := require.New(t)
+
+	server := newGitHubTestServer(t, true)
+	defer server.Close()
+
+	provider := git.NewGitHubAPIProvider(server.URL+"/api/v3", "token", "owner/repo", server.Client())
+	pr, err := provider.CreateChangeRequest(context.TODO(), git.ChangeRequestOpts{
+		Title:  "chore: update goplicate snippets",
+		Body:   "# Update goplicate snippets",
+		Head:   "chore/update-goplicate-snippets",
+		Labels: []string{"goplicate"},
+	})
+	r.NoError(err)
+	r.Equal(&git.ChangeRequest{Number: 7, URL: "https://github.example.com/owner/repo/pull/7", AlreadyExists: true}, pr)
+
+	// The title and body of the existing pull request are kept
+	r.Equal([]string{
+		"GET /api/v3/repos/owner/repo/pulls",
+		"POST /api/v3/repos/owner/repo/issues/7/labels",
+	}, server.requests)
+}
@@ -0,0 +1,168 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+const (
+	// GitLabTokenEnv the environment variable that holds the GitLab API token
+	GitLabTokenEnv = "GITLAB_TOKEN"
+)
+
+var (
+	urlRegexp = regexp.MustCompile(`https?://\S+`)
+)
+
+// gitLabAPIProvider opens GitLab merge requests using the GitLab REST API
+type gitLabAPIProvider struct {
+	baseURL     string
+	token       string
+	projectPath string
+	httpClient  *http.Client
+}
+
+// NewGitLabAPIProvider creates a provider that uses the GitLab REST API of baseURL (e.g. https://gitlab.com)
+// to open merge requests on the project at projectPath (e.g. `group/repo`).
+// Only labels are supported out of the change request options, since reviewers and assignees require user IDs.
+// Uses http.DefaultClient if httpClient is nil.
+func NewGitLabAPIProvider(baseURL, token, projectPath string, httpClient *http.Client) ChangeRequestProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &gitLabAPIProvider{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		token:       token,
+		projectPath: projectPath,
+		httpClient:  httpClient,
+	}
+}
+
+type gitLabMergeRequest struct {
+	IID    int    `json:"iid"`
+	WebURL string `json:"web_url"`
+}
+
+type gitLabProject struct {
+	DefaultBranch string `json:"default_branch"`
+}
+
+func (g *gitLabAPIProvider) CreateChangeRequest(ctx context.Context, opts ChangeRequestOpts) (*ChangeRequest, error) {
+	targetBranch := opts.Base
+	if targetBranch == "" {
+		project := &gitLabProject{}
+		if _, err := g.do(ctx, http.MethodGet, "", nil, project); err != nil {
+			return nil, errors.Wrap(err, "Failed to get the project's default branch")
+		}
+		targetBranch = project.DefaultBranch
+	}
+
+	mr := &gitLabMergeRequest{}
+	statusCode, err := g.do(ctx, http.MethodPost, "/merge_requests", map[string]string{
+		"source_branch": opts.Head,
+		"target_branch": targetBranch,
+		"title":         opts.Title,
+		"description":   opts.Body,
+		"labels":        strings.Join(opts.Labels, ","),
+	}, mr)
+	if statusCode == http.StatusConflict {
+		return g.getOpenMergeRequest(ctx, opts)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "Failed to create a merge request")
+	}
+
+	return &ChangeRequest{Number: mr.IID, URL: mr.WebURL}, nil
+}
+
+// getOpenMergeRequest returns the open merge request of the source branch, and updates its title and description
+// if opts.UpdateExisting is set
+func (g *gitLabAPIProvider) getOpenMergeRequest(
+	ctx context.Context,
+	opts ChangeRequestOpts,
+) (*ChangeRequest, error) {
+	query := url.Values{"source_branch": {opts.Head}, "state": {"opened"}}
+	mrs := []*gitLabMergeRequest{}
+	if _, err := g.do(ctx, http.MethodGet, "/merge_requests?"+query.Encode(), nil, &mrs); err != nil {
+		return nil, errors.Wrap(err, "Failed to list merge requests")
+	}
+
+	if len(mrs) == 0 {
+		return nil, errors.Errorf("No open merge request found for branch '%s'", opts.Head)
+	}
+
+	mr := mrs[0]
+	if !opts.UpdateExisting {
+		return &ChangeRequest{Number: mr.IID, URL: mr.WebURL, AlreadyExists: true}, nil
+	}
+
+	if _, err := g.do(ctx, http.MethodPut, fmt.Sprintf("/merge_requests/%d", mr.IID), map[string]string{
+		"title":       opts.Title,
+		"description": opts.Body,
+		"add_labels":  strings.Join(opts.Labels, ","),
+	}, mr); err != nil {
+		return nil, errors.Wrapf(err, "Failed to update merge request !%d", mr.IID)
+	}
+
+	return &ChangeRequest{Number: mr.IID, URL: mr.WebURL, AlreadyExists: true}, nil
+}
+
+// do performs a request on the project API resource and decodes the JSON response into out
+func (g *gitLabAPIProvider) do(ctx context.Context, method, resource string, body, out interface{}) (int, error) {
+	reqURL := fmt.Sprintf("%s/api/v4/projects/%s%s", g.baseURL, url.PathEscape(g.projectPath), resource)
+
+	return doJSONRequest(ctx, g.httpClient, method, reqURL, map[string]string{"PRIVATE-TOKEN": g.token}, body, out)
+}
+
+// gitLabCLIProvider opens GitLab merge requests using the GitLab CLI (`glab`)
+type gitLabCLIProvider struct {
+	cmdRunner *utils.CommandRunner
+}
+
+func NewGitLabCLIProvider(cmdRunner *utils.CommandRunner) ChangeRequestProvider {
+	return &gitLabCLIProvider{cmdRunner: cmdRunner}
+}
+
+func (g *gitLabCLIProvider) CreateChangeRequest(ctx context.Context, opts ChangeRequestOpts) (*ChangeRequest, error) {
+	args := []string{
+		"mr", "create", "--yes",
+		"--title", opts.Title,
+		"--description", opts.Body,
+		"--source-branch", opts.Head,
+	}
+	if opts.Base != "" {
+		args = append(args, "--target-branch", opts.Base)
+	}
+	args = append(args, cliListArgs("--label", opts.Labels)...)
+	args = append(args, cliListArgs("--reviewer", opts.Reviewers)...)
+	args = append(args, cliListArgs("--assignee", opts.Assignees)...)
+
+	resp, err := g.cmdRunner.Run(ctx, "glab", args...)
+	alreadyExists := strings.Contains(resp, "already exists")
+	if err != nil && !alreadyExists {
+		return nil, errors.Wrapf(err, "Failed to create a merge request: %s", resp)
+	}
+
+	mrURL := urlRegexp.FindString(resp)
+	if mrURL == "" {
+		return nil, errors.Errorf("Failed to find the merge request url in the output: %s", resp)
+	}
+
+	if alreadyExists && opts.UpdateExisting {
+		updateArgs := []string{"mr", "update", opts.Head, "--title", opts.Title, "--description", opts.Body}
+		updateArgs = append(updateArgs, cliListArgs("--label", opts.Labels)...)
+		if output, err := g.cmdRunner.Run(ctx, "glab", updateArgs...); err != nil {
+			return nil, errors.Wrapf(err, "Failed to update merge request '%s': %s", mrURL, output)
+		}
+	}
+
+	return &ChangeRequest{URL: mrURL, AlreadyExists: alreadyExists}, nil
+}
@@ -0,0 +1,114 @@
+package git_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg/git"
+)
+
+func newGitLabTestServer(t *testing.T, mrExists bool, updates *int) *httptest.Server {
+	r := require.New(t)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.Equal("token", req.Header.Get("PRIVATE-TOKEN"))
+
+		switch {
+		case req.URL.EscapedPath() == "/api/v4/projects/group%2Frepo":
+			_, _ = w.Write([]byte(`{"default_branch": "main"}`))
+		case req.URL.EscapedPath() == "/api/v4/projects/group%2Frepo/merge_requests/2":
+			r.Equal(http.MethodPut, req.Method)
+			body := map[string]string{}
+			r.NoError(json.NewDecoder(req.Body).Decode(&body))
+			r.Equal("# Update goplicate snippets", body["description"])
+			*updates++
+			_, _ = w.Write([]byte(`{"iid": 2, "web_url": "https://gitlab.example.com/group/repo/-/merge_requests/2"}`))
+		case req.URL.EscapedPath() != "/api/v4/projects/group%2Frepo/merge_requests":
+			w.WriteHeader(http.StatusNotFound)
+		case req.Method == http.MethodPost:
+			body := map[string]string{}
+			r.NoError(json.NewDecoder(req.Body).Decode(&body))
+			r.Equal("chore/update-goplicate-snippets", body["source_branch"])
+			r.Equal("main", body["target_branch"])
+			r.Equal("chore: update goplicate snippets", body["title"])
+
+			if mrExists {
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte(`{"message": ["Another open merge request already exists for this source branch"]}`))
+
+				return
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"iid": 1, "web_url": "https://gitlab.example.com/group/repo/-/merge_requests/1"}`))
+		case req.Method == http.MethodGet:
+			r.Equal("chore/update-goplicate-snippets", req.URL.Query().Get("source_branch"))
+			r.Equal("opened", req.URL.Query().Get("state"))
+			_, _ = w.Write([]byte(`[{"iid": 2, "web_url": "https://gitlab.example.com/group/repo/-/merge_requests/2"}]`))
+		}
+	}))
+}
+
+func TestGitLabAPIProvider_Create(t *testing.T) {
+	r := require.New(t)
+
+	server := newGitLabTestServer(t, false, new(int))
+	defer server.Close()
+
+	provider := git.NewGitLabAPIProvider(server.URL, "token", "group/repo", server.Client())
+	mr, err := provider.CreateChangeRequest(context.TODO(), git.ChangeRequestOpts{
+		Title: "chore: update goplicate snippets",
+		Body:  "# Update goplicate snippets",
+		Head:  "chore/update-goplicate-snippets",
+	})
+	r.NoError(err)
+	r.Equal(&git.ChangeRequest{Number: 1, URL: "https://gitlab.example.com/group/repo/-/merge_requests/1"}, mr)
+}
+
+func TestGitLabAPIProvider_AlreadyExists(t *testing.T) {
+	r := require.New(t)
+
+	updates := 0
+	server := newGitLabTestServer(t, true, &updates)
+	defer server.Close()
+
+	provider := git.NewGitLabAPIProvider(server.URL, "token", "group/repo", server.Client())
+	mr, err := provider.CreateChangeRequest(context.TODO(), git.ChangeRequestOpts{
+		Title: "chore: update goplicate snippets",
+		Body:  "# Update goplicate snippets",
+		Head:  "chore/update-goplicate-snippets",
+		Base:  "main",
+	})
+	r.NoError(err)
+	r.Equal(&git.ChangeRequest{
+		Number:        2,
+		URL:           "https://gitlab.example.com/group/repo/-/merge_requests/2",
+		AlreadyExists: true,
+	}, mr)
+	r.Equal(0, updates)
+}
+
+func TestGitLabAPIProvider_UpdateExisting(t *testing.T) {
+	r := require.New(t)
+
+	updates := 0
+	server := newGitLabTestServer(t, true, &updates)
+	defer server.Close()
+
+	provider := git.NewGitLabAPIProvider(server.URL, "token", "group/repo", server.Client())
+	mr, err := provider.CreateChangeRequest(context.TODO(), git.ChangeRequestOpts{
+		Title:          "chore: update goplicate snippets",
+		Body:           "# Update goplicate snippets",
+		Head:           "chore/update-goplicate-snippets",
+		Base:           "main",
+		UpdateExisting: true,
+	})
+	r.NoError(err)
+	r.Equal(2, mr.Number)
+	r.Equal(1, updates)
+}
@@ -0,0 +1,63 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// doJSONRequest sends a request with a JSON encoded body (if not nil) and decodes the JSON response into out
+// (if not nil). Returns the response status code, and an error for non-2xx responses.
+func doJSONRequest(
+	ctx context.Context,
+	httpClient *http.Client,
+	method, reqURL string,
+	headers map[string]string,
+	body, out interface{},
+) (int, error) {
+	var reqBody io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return 0, errors.Wrap(err, "Failed to encode request body")
+		}
+		reqBody = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, reqBody)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to send request '%s %s'", method, reqURL)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, errors.Wrap(err, "Failed to read response body")
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.Errorf("Request '%s %s' failed with status %d: %s",
+			method, reqURL, resp.StatusCode, string(respBytes))
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBytes, out); err != nil {
+			return resp.StatusCode, errors.Wrap(err, "Failed to decode response body")
+		}
+	}
+
+	return resp.StatusCode, nil
+}
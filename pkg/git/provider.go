@@ -0,0 +1,123 @@
+package git
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+var (
+	// scpLikeURLRegexp matches remote URLs of the form `[user@]host:path`
+	scpLikeURLRegexp = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+)
+
+// ChangeRequestProvider opens change requests (e.g. GitHub pull requests or GitLab merge requests)
+type ChangeRequestProvider interface {
+	// CreateChangeRequest opens a change request, or returns the existing one if it's already open.
+	// The title and body of the existing one are updated if opts.UpdateExisting is set.
+	CreateChangeRequest(ctx context.Context, opts ChangeRequestOpts) (*ChangeRequest, error)
+}
+
+// ChangeRequestOpts the options to open a change request with
+type ChangeRequestOpts struct {
+	Title string
+	Body  string
+	// Head the branch that contains the changes
+	Head string
+	// Base the branch to merge the changes into. The default branch of the repository if empty.
+	Base      string
+	Labels    []string
+	Reviewers []string
+	Assignees []string
+	// UpdateExisting whether to update the title and body of the change request if it's already open
+	UpdateExisting bool
+}
+
+// ChangeRequest an opened change request
+type ChangeRequest struct {
+	Number int
+	URL    string
+	// AlreadyExists whether the change request was already open before
+	AlreadyExists bool
+}
+
+// RemoteRepository the location of a repository on a git hosting service
+type RemoteRepository struct {
+	Host string
+	// Path the path of the repository on the host, without a `.git` suffix (e.g. `group/subgroup/repo`)
+	Path string
+}
+
+// ParseRemoteURL parses a git remote URL of the forms `https://host/path.git` or `git@host:path.git`
+func ParseRemoteURL(remoteURL string) (*RemoteRepository, error) {
+	var host, repoPath string
+	if u, err := url.Parse(remoteURL); err == nil && u.Scheme != "" && u.Host != "" {
+		host, repoPath = u.Hostname(), u.Path
+	} else if matches := scpLikeURLRegexp.FindStringSubmatch(remoteURL); matches != nil {
+		host, repoPath = matches[1], matches[2]
+	} else {
+		return nil, errors.Errorf("Failed to parse remote url '%s'", remoteURL)
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if repoPath == "" {
+		return nil, errors.Errorf("Remote url '%s' has no repository path", remoteURL)
+	}
+
+	return &RemoteRepository{Host: host, Path: repoPath}, nil
+}
+
+// DetectProvider returns the provider configured in publishCfg, or detects it from the remote repository host.
+// Defaults to GitHub.
+func DetectProvider(publishCfg config.Publish, remote *RemoteRepository) string {
+	if publishCfg.Provider != "" {
+		return publishCfg.Provider
+	}
+
+	if strings.Contains(remote.Host, config.ProviderGitLab) {
+		return config.ProviderGitLab
+	}
+
+	return config.ProviderGitHub
+}
+
+// NewChangeRequestProvider creates the change request provider that matches the publish config and remote origin
+func NewChangeRequestProvider(
+	publishCfg config.Publish,
+	remoteOriginURL string,
+	cmdRunner *utils.CommandRunner,
+) (ChangeRequestProvider, error) {
+	remote, err := ParseRemoteURL(remoteOriginURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch DetectProvider(publishCfg, remote) {
+	case config.ProviderGitLab:
+		token := os.Getenv(GitLabTokenEnv)
+		if token == "" {
+			return NewGitLabCLIProvider(cmdRunner), nil
+		}
+
+		baseURL := publishCfg.BaseURL
+		if baseURL == "" {
+			baseURL = "https://" + remote.Host
+		}
+
+		return NewGitLabAPIProvider(baseURL, token, remote.Path, nil), nil
+	default:
+		token := os.Getenv(GitHubTokenEnv)
+		if token == "" {
+			return NewGitHubCLIProvider(cmdRunner), nil
+		}
+
+		return NewGitHubAPIProvider(gitHubAPIURL(publishCfg.BaseURL, remote.Host), token, remote.Path, nil), nil
+	}
+}
@@ -0,0 +1,54 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
+)
+
+func TestParseRemoteURL(t *testing.T) {
+	r := require.New(t)
+
+	tests := []struct {
+		remoteURL string
+		expected  *git.RemoteRepository
+	}{
+		{
+			remoteURL: "https://github.com/ilaif/goplicate.git",
+			expected:  &git.RemoteRepository{Host: "github.com", Path: "ilaif/goplicate"},
+		},
+		{
+			remoteURL: "git@gitlab.example.com:group/subgroup/repo.git",
+			expected:  &git.RemoteRepository{Host: "gitlab.example.com", Path: "group/subgroup/repo"},
+		},
+		{
+			remoteURL: "ssh://git@gitlab.com:2222/group/repo",
+			expected:  &git.RemoteRepository{Host: "gitlab.com", Path: "group/repo"},
+		},
+	}
+
+	for _, test := range tests {
+		remote, err := git.ParseRemoteURL(test.remoteURL)
+		r.NoError(err)
+		r.Equal(test.expected, remote)
+	}
+
+	_, err := git.ParseRemoteURL("not-a-remote")
+	r.Error(err)
+}
+
+func TestDetectProvider(t *testing.T) {
+	r := require.New(t)
+
+	gitlabRemote := &git.RemoteRepository{Host: "gitlab.example.com", Path: "group/repo"}
+	githubRemote := &git.RemoteRepository{Host: "github.com", Path: "ilaif/goplicate"}
+	customRemote := &git.RemoteRepository{Host: "git.example.com", Path: "group/repo"}
+
+	r.Equal(config.ProviderGitLab, git.DetectProvider(config.Publish{}, gitlabRemote))
+	r.Equal(config.ProviderGitHub, git.DetectProvider(config.Publish{}, githubRemote))
+	r.Equal(config.ProviderGitHub, git.DetectProvider(config.Publish{}, customRemote))
+	r.Equal(config.ProviderGitLab, git.DetectProvider(config.Publish{Provider: config.ProviderGitLab}, customRemote))
+}
@@ -3,6 +3,8 @@ package git
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/caarlos0/log"
@@ -10,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/samber/lo"
 
+	"github.com/ilaif/goplicate/pkg/config"
 	"github.com/ilaif/goplicate/pkg/shared"
 	"github.com/ilaif/goplicate/pkg/utils"
 )
@@ -20,34 +23,50 @@ type Publisher struct {
 	baseBranch  string
 	dir         string
 	branch      string
+	publishCfg  config.Publish
 
 	cmdRunner *utils.CommandRunner
 	repo      *git.Repository
 	status    git.Status
 }
 
-func NewPublisher(sharedState *shared.State, baseBranch string, dir string, branch string) *Publisher {
+func NewPublisher(
+	sharedState *shared.State,
+	baseBranch string,
+	dir string,
+	branch string,
+	publishCfg config.Publish,
+) *Publisher {
 	cmdRunner := utils.NewCommandRunner(dir)
 
-	return &Publisher{sharedState: sharedState, baseBranch: baseBranch, dir: dir, branch: branch, cmdRunner: cmdRunner}
+	return &Publisher{
+		sharedState: sharedState,
+		baseBranch:  baseBranch,
+		dir:         dir,
+		branch:      branch,
+		publishCfg:  publishCfg,
+		cmdRunner:   cmdRunner,
+	}
 }
 
 func (p *Publisher) Init(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
 	var err error
 
-	log.Debugf("Opening repository '%s'", p.dir)
+	logger.Debugf("Opening repository '%s'", p.dir)
 	p.repo, err = git.PlainOpen(p.dir)
 	if err != nil {
 		return errors.Wrap(err, "Failed to open repository")
 	}
 
-	log.Debug("Opening worktree")
+	logger.Debug("Opening worktree")
 	worktree, err := p.repo.Worktree()
 	if err != nil {
 		return errors.Wrap(err, "Failed to open worktree")
 	}
 
-	log.Debug("Getting worktree status")
+	logger.Debug("Getting worktree status")
 	p.status, err = worktree.Status()
 	if err != nil {
 		return errors.Wrap(err, "Failed to get worktree status")
@@ -57,13 +76,15 @@ func (p *Publisher) Init(ctx context.Context) error {
 }
 
 func (p *Publisher) StashChanges(ctx context.Context) (func() error, error) {
-	log.Debug("Stashing working directory changes")
+	logger := log.FromContext(ctx)
+
+	logger.Debug("Stashing working directory changes")
 	if output, err := p.cmdRunner.Run(ctx, "git", "stash"); err != nil {
 		return nil, errors.Wrapf(err, "Failed to stash local changes: %s", output)
 	}
 
 	return func() error {
-		log.Debug("Cleanup: Un-stashing working directory changes")
+		logger.Debug("Cleanup: Un-stashing working directory changes")
 		if output, err := p.cmdRunner.Run(ctx, "git", "stash", "pop"); err != nil {
 			return errors.Wrapf(err, "Cleanup: Failed to restore local changes: %s", output)
 		}
@@ -76,131 +97,299 @@ func (p *Publisher) IsClean() bool {
 	return p.status.IsClean()
 }
 
-func (p *Publisher) Publish(ctx context.Context, filePaths []string, confirm bool) error {
-	log.Info("Publishing changes...")
+// Publish commits the changes to a new branch, pushes it and opens a change request.
+// The branch name, commit message, title and body are rendered from the publish templates with the change set.
+func (p *Publisher) Publish(ctx context.Context, changeSet *ChangeSet, confirm bool) (*ChangeRequest, error) {
+	logger := log.FromContext(ctx)
+
+	logger.Info("Publishing changes...")
+
+	branchName, err := changeSet.render("branch", p.publishCfg.Branch, defaultBranch)
+	if err != nil {
+		return nil, err
+	}
+	if p.branch != "" {
+		branchName = p.branch
+	}
+
+	commitMsg, err := changeSet.render("commit message", p.publishCfg.CommitMessage, defaultCommitMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	title, err := changeSet.render("title", p.publishCfg.Title, strings.SplitN(commitMsg, "\n", 2)[0])
+	if err != nil {
+		return nil, err
+	}
 
-	log.Debug("Fetching current branch name")
-	origBranchName, err := p.cmdRunner.Run(ctx, "git", "rev-parse", "--abbrev-ref", "HEAD")
+	prBody, err := changeSet.render("body", p.publishCfg.Body, changeSet.Markdown())
 	if err != nil {
-		return errors.Wrapf(err, "Failed to fetch current branch name: %s", origBranchName)
+		return nil, err
+	}
+
+	origBranchName, detached, err := p.currentRef(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	baseBranch := origBranchName
+	if p.baseBranch != "" {
+		baseBranch = p.baseBranch
 	}
-	origBranchName = strings.Trim(origBranchName, "\n")
 
 	if p.baseBranch != "" {
-		log.Debugf("Checking out base branch '%s'", p.baseBranch)
+		logger.Debugf("Checking out base branch '%s'", p.baseBranch)
 		if output, err := p.cmdRunner.Run(ctx, "git", "checkout", p.baseBranch); err != nil {
-			return errors.Wrapf(err, "Failed to checkout base branch '%s': %s", p.baseBranch, output)
+			return nil, errors.Wrapf(err, "Failed to checkout base branch '%s': %s", p.baseBranch, output)
 		}
 	}
 	defer func() {
-		log.Debugf("Cleanup: Checking out original branch '%s'", origBranchName)
+		logger.Debugf("Cleanup: Checking out original branch '%s'", origBranchName)
 		if output, err := p.cmdRunner.Run(ctx, "git", "checkout", string(origBranchName)); err != nil {
-			log.WithError(err).Errorf("Cleanup: Failed to checkout back to original branch '%s': %s", p.baseBranch, output)
+			logger.WithError(err).Errorf("Cleanup: Failed to checkout back to original branch '%s': %s", p.baseBranch, output)
 		}
 	}()
 
-	log.Debugf("Pulling from remote")
-	if output, err := p.cmdRunner.Run(ctx, "git", "pull"); err != nil {
-		return errors.Wrapf(err, "Failed to pull branch: %s", output)
-	}
-
-	log.Debug("Fetching HEAD reference")
-	branchName := "chore/update-goplicate-snippets"
-	if p.branch != "" {
-		branchName = p.branch
+	if !detached || p.baseBranch != "" {
+		logger.Debugf("Pulling from remote")
+		if output, err := p.cmdRunner.Run(ctx, "git", "pull"); err != nil {
+			return nil, errors.Wrapf(err, "Failed to pull branch: %s", output)
+		}
 	}
 
-	log.Debugf("Deleting existing branch '%s' if exists", branchName)
+	logger.Debugf("Deleting existing branch '%s' if exists", branchName)
 	if output, err := p.cmdRunner.Run(ctx, "git", "branch", "-D", branchName); err != nil {
-		log.WithError(err).Debugf("Failed to delete existing branch '%s': %s", branchName, output)
+		logger.WithError(err).Debugf("Failed to delete existing branch '%s': %s", branchName, output)
 	}
 
 	remoteOriginURL, err := p.cmdRunner.Run(ctx, "git", "config", "--get", "remote.origin.url")
 	remoteOriginURL = strings.Trim(remoteOriginURL, "\n")
 	if err != nil {
-		return errors.Wrapf(err, "Failed to get remote origin url: %s", remoteOriginURL)
+		return nil, errors.Wrapf(err, "Failed to get remote origin url: %s", remoteOriginURL)
+	}
+
+	provider, err := NewChangeRequestProvider(p.publishCfg, remoteOriginURL, p.cmdRunner)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create a change request provider")
 	}
 
 	output, err := p.cmdRunner.Run(ctx, "git", "ls-remote", "--heads", remoteOriginURL, branchName)
 	if err != nil {
-		return errors.Wrapf(err, "Failed to list remote branches: %s", output)
+		return nil, errors.Wrapf(err, "Failed to list remote branches: %s", output)
 	}
-	if strings.Contains(output, fmt.Sprintf("refs/heads/%s", branchName)) {
-		// Remote branch exists
+	filePaths := lo.Uniq(append(append(changeSet.TargetPaths(), changeSet.Files...), lo.Keys(p.status)...))
+	remoteBranchExists := strings.Contains(output, fmt.Sprintf("refs/heads/%s", branchName))
+	updateInPlace := remoteBranchExists && p.publishCfg.UpdateInPlace
+
+	if updateInPlace {
+		if err := p.checkoutExistingBranch(ctx, branchName, baseBranch, filePaths); err != nil {
+			return nil, err
+		}
+	} else if remoteBranchExists {
 		question := fmt.Sprintf("Found branch '%s' in origin. Do you want to delete it?", branchName)
 		answer, err := utils.PromptUserYesNoQuestion(question, confirm)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if answer {
 			output, err := p.cmdRunner.Run(ctx, "git", "push", "-d", "origin", branchName)
 			if err != nil {
-				return errors.Wrapf(err, "Failed to delete existing remote branch '%s': %s", branchName, output)
+				return nil, errors.Wrapf(err, "Failed to delete existing remote branch '%s': %s", branchName, output)
 			}
 		} else {
-			log.Infof("Skipped deletion of branch '%s'", branchName)
+			logger.Infof("Skipped deletion of branch '%s'", branchName)
 		}
 	}
 
-	log.Debugf("Checking out new branch '%s'", branchName)
-	if output, err := p.cmdRunner.Run(ctx, "git", "checkout", "-b", branchName); err != nil {
-		return errors.Wrapf(err, "Failed to checkout new branch '%s': %s", branchName, output)
+	if !updateInPlace {
+		logger.Debugf("Checking out new branch '%s'", branchName)
+		if output, err := p.cmdRunner.Run(ctx, "git", "checkout", "-b", branchName); err != nil {
+			return nil, errors.Wrapf(err, "Failed to checkout new branch '%s': %s", branchName, output)
+		}
 	}
 
-	filePaths = lo.Uniq(append(filePaths, lo.Keys(p.status)...))
 	for _, path := range filePaths {
-		log.Debugf("Adding file '%s' to the worktree", path)
+		logger.Debugf("Adding file '%s' to the worktree", path)
 		if output, err := p.cmdRunner.Run(ctx, "git", "add", path); err != nil {
-			return errors.Wrapf(err, "Failed to add files to the worktree: %s", output)
+			return nil, errors.Wrapf(err, "Failed to add files to the worktree: %s", output)
 		}
 	}
 
-	log.Debug("Committing changes")
-	commitMsg := "chore: update goplicate snippets"
-	if output, err := p.cmdRunner.Run(ctx, "git", "commit", "-m", commitMsg); err != nil {
-		return errors.Wrapf(err, "Failed to commit changes: %s", output)
+	updatedPaths := []string{}
+	if updateInPlace {
+		output, err := p.cmdRunner.Run(ctx, "git", "diff", "--cached", "--name-only")
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list staged changes: %s", output)
+		}
+		updatedPaths = lo.Compact(strings.Split(output, "\n"))
+	}
+
+	if updateInPlace && len(updatedPaths) == 0 {
+		logger.Infof("Branch '%s' is already up to date", branchName)
+	} else {
+		logger.Debug("Committing changes")
+		if output, err := p.cmdRunner.Run(ctx, "git", "commit", "-m", commitMsg); err != nil {
+			return nil, errors.Wrapf(err, "Failed to commit changes: %s", output)
+		}
 	}
 
-	log.Debug("Pushing changes")
-	if output, err := p.cmdRunner.Run(ctx, "git", "push", "-u", "origin", branchName); err != nil {
-		return errors.Wrapf(err, "Failed to push changes: %s", output)
+	logger.Debug("Pushing changes")
+	pushArgs := []string{"push", "-u", "origin", branchName}
+	if updateInPlace {
+		// The existing branch was rebased, so its history might have been rewritten
+		pushArgs = append(pushArgs, "--force-with-lease")
+	}
+	if output, err := p.cmdRunner.Run(ctx, "git", pushArgs...); err != nil {
+		return nil, errors.Wrapf(err, "Failed to push changes: %s", output)
 	}
 
-	prBody := "# Update goplicate snippets"
-	// Populate the shared state with the user input
-	if !confirm && p.sharedState.Message == "" {
+	// A message that was given explicitly is shared by all projects, while the generated body describes the
+	// changes of this project only, so it's edited for this project alone
+	if p.sharedState.Message != "" {
+		prBody = p.sharedState.Message
+	} else if !confirm {
 		question := "Do you want to open a text editor to modify the change request message?"
 		answer, err := utils.PromptUserYesNoQuestion(question, confirm)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if answer {
 			output, err := utils.OpenTextEditor(ctx, prBody)
 			if err != nil {
-				return errors.Wrap(err, "Failed to prompt for message")
+				return nil, errors.Wrap(err, "Failed to prompt for message")
 			}
 
-			p.sharedState.Message = output
+			prBody = output
 		}
 	}
-	if p.sharedState.Message != "" {
-		prBody = p.sharedState.Message
+	if updateInPlace && len(updatedPaths) > 0 {
+		prBody += "\n\n---\n\n" + changeSet.only(updatedPaths).markdown("**Latest update**")
 	}
 
-	log.Debug("Creating pull request")
-	resp, err := p.cmdRunner.Run(ctx, "gh", "pr", "create", "--title", commitMsg, "--body", prBody, "--head", branchName)
-	resp = strings.TrimSuffix(resp, "\n")
-	alreadyExists := strings.Contains(resp, "already exists:")
-	if err != nil && !alreadyExists {
-		return errors.Wrapf(err, "Failed to create a PR: %s", resp)
+	logger.Debug("Creating change request")
+	changeRequest, err := provider.CreateChangeRequest(ctx, ChangeRequestOpts{
+		Title:          title,
+		Body:           prBody,
+		Head:           branchName,
+		Base:           p.baseBranch,
+		Labels:         p.publishCfg.Labels,
+		Reviewers:      p.publishCfg.Reviewers,
+		Assignees:      p.publishCfg.Assignees,
+		UpdateExisting: updateInPlace,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if alreadyExists {
-		log.Warnf("PR already exists: %s", resp)
+	if changeRequest.AlreadyExists && updateInPlace {
+		logger.Infof("Updated PR: %s", changeRequest.URL)
+	} else if changeRequest.AlreadyExists {
+		logger.Warnf("PR already exists: %s", changeRequest.URL)
 	} else {
-		log.Infof("Created PR: %s", resp)
+		logger.Infof("Created PR: %s", changeRequest.URL)
+	}
+
+	return changeRequest, nil
+}
+
+// currentRef returns the current branch, or the current commit if HEAD is detached (e.g. a cached clone of
+// a project), so that it can be checked out again when done
+func (p *Publisher) currentRef(ctx context.Context) (string, bool, error) {
+	logger := log.FromContext(ctx)
+
+	logger.Debug("Fetching current branch name")
+	branchName, err := p.cmdRunner.Run(ctx, "git", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", false, errors.Wrapf(err, "Failed to fetch current branch name: %s", branchName)
+	}
+	branchName = strings.Trim(branchName, "\n")
+
+	if branchName != "HEAD" {
+		return branchName, false, nil
+	}
+
+	commit, err := ResolveCommit(ctx, p.dir)
+	if err != nil {
+		return "", false, err
+	}
+
+	return commit, true, nil
+}
+
+// checkoutExistingBranch checks out the existing remote branch, rebases it on top of baseBranch and re-applies
+// the current contents of filePaths on top of it
+func (p *Publisher) checkoutExistingBranch(
+	ctx context.Context,
+	branchName, baseBranch string,
+	filePaths []string,
+) error {
+	logger := log.FromContext(ctx)
+
+	// Keep the updated contents in memory, since the files can conflict with the ones in the existing branch
+	contents := map[string][]byte{}
+	for _, path := range filePaths {
+		content, err := os.ReadFile(filepath.Join(p.dir, path))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err, "Failed to read file '%s'", path)
+		}
+		contents[path] = content
+	}
+
+	logger.Debug("Stashing the updated files")
+	output, err := p.cmdRunner.Run(ctx, "git", "stash", "push", "--include-untracked", "-m", "goplicate")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to stash the updated files: %s", output)
+	}
+	stashed := !strings.Contains(output, "No local changes to save")
+
+	logger.Debugf("Fetching existing branch '%s'", branchName)
+	remoteRef := fmt.Sprintf("refs/remotes/origin/%s", branchName)
+	refSpec := fmt.Sprintf("%s:%s", branchName, remoteRef)
+	if output, err := p.cmdRunner.Run(ctx, "git", "fetch", "origin", refSpec); err != nil {
+		return errors.Wrapf(err, "Failed to fetch branch '%s' (updates are kept in the stash): %s", branchName, output)
+	}
+
+	logger.Debugf("Checking out existing branch '%s'", branchName)
+	if output, err := p.cmdRunner.Run(ctx, "git", "checkout", "-B", branchName, remoteRef); err != nil {
+		return errors.Wrapf(err, "Failed to checkout branch '%s' (updates are kept in the stash): %s", branchName, output)
+	}
+
+	logger.Debugf("Rebasing branch '%s' on top of '%s'", branchName, baseBranch)
+	if output, err := p.cmdRunner.Run(ctx, "git", "rebase", baseBranch); err != nil {
+		if abortOutput, err := p.cmdRunner.Run(ctx, "git", "rebase", "--abort"); err != nil {
+			logger.WithError(err).Warnf("Failed to abort rebase: %s", abortOutput)
+		}
+
+		return errors.Wrapf(err, "Failed to rebase branch '%s' on top of '%s' (updates are kept in the stash): %s",
+			branchName, baseBranch, output)
+	}
+
+	logger.Debug("Re-applying the updated files")
+	for path, content := range contents {
+		absPath := filepath.Join(p.dir, path)
+		if content == nil {
+			if err := os.Remove(absPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return errors.Wrapf(err, "Failed to remove file '%s'", path)
+			}
+
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(absPath), 0750); err != nil {
+			return errors.Wrapf(err, "Failed to create the directory of file '%s'", path)
+		}
+
+		if err := os.WriteFile(absPath, content, 0600); err != nil {
+			return errors.Wrapf(err, "Failed to write file '%s'", path)
+		}
+	}
+
+	if stashed {
+		if output, err := p.cmdRunner.Run(ctx, "git", "stash", "drop"); err != nil {
+			logger.WithError(err).Warnf("Failed to drop the stashed updates: %s", output)
+		}
 	}
 
 	return nil
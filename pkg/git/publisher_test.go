@@ -0,0 +1,202 @@
+package git_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg/cmd/testutils"
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
+	"github.com/ilaif/goplicate/pkg/shared"
+)
+
+const testBranch = "chore/update-goplicate-snippets"
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
+// prepareRepository creates a local clone of a bare repository that already has a published
+// goplicate branch with an additional reviewer commit.
+// The clone's origin url looks like a GitHub url, but is rewritten to the bare repository.
+func prepareRepository(t *testing.T, remoteURL string) string {
+	tmpDir := t.TempDir()
+	originDir := filepath.Join(tmpDir, "origin.git")
+	workDir := filepath.Join(tmpDir, "work")
+
+	testutils.RunGit(t, tmpDir, "init", "--bare", originDir)
+	testutils.RunGit(t, tmpDir, "clone", originDir, workDir)
+	testutils.RunGit(t, workDir, "config", "user.name", "goplicate")
+	testutils.RunGit(t, workDir, "config", "user.email", "goplicate@example.com")
+	testutils.RunGit(t, workDir, "checkout", "-b", "main")
+	writeFile(t, filepath.Join(workDir, "config.yaml"), "version: 1\n")
+	testutils.RunGit(t, workDir, "add", ".")
+	testutils.RunGit(t, workDir, "commit", "-m", "initial commit")
+	testutils.RunGit(t, workDir, "push", "-u", "origin", "main")
+
+	testutils.RunGit(t, workDir, "checkout", "-b", testBranch)
+	writeFile(t, filepath.Join(workDir, "config.yaml"), "version: 2\n")
+	testutils.RunGit(t, workDir, "commit", "-am", "chore: update goplicate snippets")
+	writeFile(t, filepath.Join(workDir, "review.txt"), "addressed review comments\n")
+	testutils.RunGit(t, workDir, "add", ".")
+	testutils.RunGit(t, workDir, "commit", "-m", "address review comments")
+	testutils.RunGit(t, workDir, "push", "-u", "origin", testBranch)
+	testutils.RunGit(t, workDir, "checkout", "main")
+	testutils.RunGit(t, workDir, "branch", "-D", testBranch)
+
+	testutils.RunGit(t, workDir, "remote", "set-url", "origin", remoteURL)
+	testutils.RunGit(t, workDir, "config", "url."+originDir+".insteadOf", remoteURL)
+
+	return workDir
+}
+
+func TestPublisher_UpdateInPlace(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	server := newGitHubTestServer(t, true)
+	defer server.Close()
+	t.Setenv(git.GitHubTokenEnv, "token")
+
+	workDir := prepareRepository(t, "https://github.example.com/owner/repo.git")
+	writeFile(t, filepath.Join(workDir, "config.yaml"), "version: 3\n")
+
+	publisher := git.NewPublisher(&shared.State{}, "", workDir, "", config.Publish{
+		BaseURL:       server.URL,
+		UpdateInPlace: true,
+	})
+	r.NoError(publisher.Init(ctx))
+
+	changeRequest, err := publisher.Publish(ctx, &git.ChangeSet{Targets: []*git.ChangedTarget{{
+		Path:   "config.yaml",
+		Blocks: []*git.ChangedBlock{{Name: "version", Diff: "-version: 1\n+version: 3"}},
+	}}}, true)
+	r.NoError(err)
+	r.Equal(&git.ChangeRequest{
+		Number:        7,
+		URL:           "https://github.example.com/owner/repo/pull/7",
+		AlreadyExists: true,
+	}, changeRequest)
+	r.Contains(server.bodies["PATCH /api/v3/repos/owner/repo/pulls/7"]["body"],
+		"---\n\n**Latest update**\n\n## `config.yaml`\n\nSynced from ``\n\n### Block `version`\n\n"+
+			"<details>\n<summary>Diff</summary>\n\n```diff\n-version: 1\n+version: 3\n```")
+
+	// The existing history is kept, and the update is committed on top of it
+	log := testutils.RunGit(t, workDir, "log", "--format=%s", "origin/"+testBranch)
+	r.Equal("chore: update goplicate snippets\naddress review comments\nchore: update goplicate snippets\n"+
+		"initial commit\n", log)
+	r.Equal("version: 3\n", testutils.RunGit(t, workDir, "show", "origin/"+testBranch+":config.yaml"))
+	r.Equal("addressed review comments\n", testutils.RunGit(t, workDir, "show", "origin/"+testBranch+":review.txt"))
+	r.Equal("main\n", testutils.RunGit(t, workDir, "rev-parse", "--abbrev-ref", "HEAD"))
+}
+
+func TestPublisher_UpdateInPlace_NoChanges(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	server := newGitHubTestServer(t, true)
+	defer server.Close()
+	t.Setenv(git.GitHubTokenEnv, "token")
+
+	workDir := prepareRepository(t, "https://github.example.com/owner/repo.git")
+	writeFile(t, filepath.Join(workDir, "config.yaml"), "version: 2\n")
+
+	publisher := git.NewPublisher(&shared.State{}, "", workDir, "", config.Publish{
+		BaseURL:       server.URL,
+		UpdateInPlace: true,
+	})
+	r.NoError(publisher.Init(ctx))
+
+	_, err := publisher.Publish(ctx, &git.ChangeSet{Targets: []*git.ChangedTarget{{Path: "config.yaml"}}}, true)
+	r.NoError(err)
+
+	log := testutils.RunGit(t, workDir, "log", "--format=%s", "origin/"+testBranch)
+	r.Equal("address review comments\nchore: update goplicate snippets\ninitial commit\n", log)
+}
+
+func TestPublisher_Templates(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	server := newGitHubTestServer(t, true)
+	defer server.Close()
+	t.Setenv(git.GitHubTokenEnv, "token")
+
+	workDir := prepareRepository(t, "https://github.example.com/owner/repo.git")
+	writeFile(t, filepath.Join(workDir, "config.yaml"), "version: 3\n")
+
+	publisher := git.NewPublisher(&shared.State{}, "", workDir, "", config.Publish{
+		BaseURL:       server.URL,
+		UpdateInPlace: true,
+		Branch:        "chore/update-goplicate-{{ index .BlockNames 0 }}",
+		CommitMessage: "chore(config): sync {{ range .Targets }}{{ .Path }}{{ end }}\n\nRefs: OPS-123",
+		Body: "{{ range .Targets }}{{ .Path }} from {{ .SourceRepository }}@{{ .SourceRef }}:\n" +
+			"{{ range .Blocks }}{{ .Diff }}{{ end }}{{ end }}",
+	})
+	r.NoError(publisher.Init(ctx))
+
+	_, err := publisher.Publish(ctx, &git.ChangeSet{Targets: []*git.ChangedTarget{{
+		Path:             "config.yaml",
+		SourceRepository: "https://github.com/org/shared",
+		SourceRef:        "v1",
+		Blocks:           []*git.ChangedBlock{{Name: "snippets", Diff: "-version: 2\n+version: 3"}},
+	}}}, true)
+	r.NoError(err)
+
+	prUpdate := server.bodies["PATCH /api/v3/repos/owner/repo/pulls/7"]
+	r.Equal("chore(config): sync config.yaml", prUpdate["title"])
+	r.Contains(prUpdate["body"], "config.yaml from https://github.com/org/shared@v1:\n-version: 2\n+version: 3")
+
+	commitMsg := testutils.RunGit(t, workDir, "log", "-1", "--format=%B", "origin/"+testBranch)
+	r.Equal("chore(config): sync config.yaml\n\nRefs: OPS-123\n\n", commitMsg)
+}
+
+func TestPublisher_SharedMessage(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	server := newGitHubTestServer(t, false)
+	defer server.Close()
+	t.Setenv(git.GitHubTokenEnv, "token")
+
+	workDir := prepareRepository(t, "https://github.example.com/owner/repo.git")
+	writeFile(t, filepath.Join(workDir, "config.yaml"), "version: 3\n")
+
+	sharedState := &shared.State{Message: "Sync the shared configs"}
+	publisher := git.NewPublisher(sharedState, "", workDir, "", config.Publish{BaseURL: server.URL})
+	r.NoError(publisher.Init(ctx))
+
+	_, err := publisher.Publish(ctx, &git.ChangeSet{Targets: []*git.ChangedTarget{{Path: "config.yaml"}}}, true)
+	r.NoError(err)
+
+	r.Equal("Sync the shared configs", server.bodies["POST /api/v3/repos/owner/repo/pulls"]["body"])
+	r.Equal("Sync the shared configs", sharedState.Message)
+}
+
+func TestPublisher_DetachedHead(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	server := newGitHubTestServer(t, false)
+	defer server.Close()
+	t.Setenv(git.GitHubTokenEnv, "token")
+
+	workDir := prepareRepository(t, "https://github.example.com/owner/repo.git")
+	testutils.RunGit(t, workDir, "checkout", "--detach", "main")
+	commit := testutils.RunGit(t, workDir, "rev-parse", "HEAD")
+	writeFile(t, filepath.Join(workDir, "config.yaml"), "version: 3\n")
+
+	publisher := git.NewPublisher(&shared.State{}, "", workDir, "", config.Publish{BaseURL: server.URL})
+	r.NoError(publisher.Init(ctx))
+
+	_, err := publisher.Publish(ctx, &git.ChangeSet{Targets: []*git.ChangedTarget{{Path: "config.yaml"}}}, true)
+	r.NoError(err)
+
+	r.Equal("version: 3\n", testutils.RunGit(t, workDir, "show", "origin/"+testBranch+":config.yaml"))
+	r.Equal("HEAD\n", testutils.RunGit(t, workDir, "rev-parse", "--abbrev-ref", "HEAD"))
+	r.Equal(commit, testutils.RunGit(t, workDir, "rev-parse", "HEAD"))
+}
@@ -0,0 +1,176 @@
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+// A repository is fetched into a single bare repository (the store), and every ref of it is checked out
+// in its own worktree. This allows holding several revisions of a repository at once without cloning it again.
+
+// initStore initializes a bare repository in storeDir that fetches from uri
+func initStore(ctx context.Context, storeDir, uri string) error {
+	if err := os.MkdirAll(storeDir, 0750); err != nil {
+		return errors.Wrapf(err, "Failed to create dir '%s'", storeDir)
+	}
+
+	cmdRunner := utils.NewCommandRunner(storeDir)
+	for _, args := range [][]string{{"init", "--quiet", "--bare"}, {"remote", "add", "origin", uri}} {
+		if output, err := cmdRunner.Run(ctx, "git", args...); err != nil {
+			return errors.Wrapf(err, "Failed to initialize repository '%s': %s", uri, output)
+		}
+	}
+
+	return nil
+}
+
+// isStore whether storeDir holds an initialized store
+func isStore(storeDir string) bool {
+	_, err := os.Stat(filepath.Join(storeDir, "config"))
+
+	return err == nil
+}
+
+// fetchRevision fetches the latest commit of the ref from the origin into the store, and returns its SHA.
+// A commit ref is only fetched if it doesn't exist in the store yet.
+func fetchRevision(ctx context.Context, storeDir, uri string, ref Ref) (string, error) {
+	logger := log.FromContext(ctx)
+	cmdRunner := utils.NewCommandRunner(storeDir)
+
+	revision := "FETCH_HEAD"
+	if ref.Commit != "" {
+		revision = ref.Commit + "^{commit}"
+		if _, err := cmdRunner.Run(ctx, "git", "cat-file", "-e", revision); err == nil {
+			logger.Debugf("Commit '%s' of repository '%s' already exists", ref.Commit, uri)
+		} else if output, err := cmdRunner.Run(ctx, "git", "fetch", "--depth", "1", "origin", ref.Commit); err != nil {
+			// Only the commit itself is fetched if the server allows it, otherwise fall back to fetching all commits
+			logger.WithError(err).Debugf("Failed to fetch commit '%s' directly, fetching all commits: %s", ref.Commit, output)
+
+			args := []string{"fetch", "origin"}
+			if _, err := os.Stat(filepath.Join(storeDir, "shallow")); err == nil {
+				args = append(args, "--unshallow")
+			}
+			if output, err := cmdRunner.Run(ctx, "git", args...); err != nil {
+				return "", errors.Wrapf(err, "Failed to fetch repository '%s': %s", uri, output)
+			}
+		}
+	} else {
+		remoteRef := "HEAD"
+		if ref.Branch != "" {
+			remoteRef = ref.Branch
+		}
+
+		if output, err := cmdRunner.Run(ctx, "git", "fetch", "--depth", "1", "origin", remoteRef); err != nil {
+			return "", errors.Wrapf(err, "Failed to fetch '%s' of repository '%s': %s", remoteRef, uri, output)
+		}
+	}
+
+	output, err := cmdRunner.Run(ctx, "git", "rev-parse", "--verify", revision)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to resolve '%s' of repository '%s': %s", ref.String(), uri, output)
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// ResolveCommit returns the SHA of the commit that is checked out in the repository that contains dir
+func ResolveCommit(ctx context.Context, dir string) (string, error) {
+	output, err := utils.NewCommandRunner(dir).Run(ctx, "git", "rev-parse", "HEAD")
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to resolve the commit of '%s': %s", dir, output)
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// checkoutWorktree checks out the commit in worktreeDir, a worktree of the store, and discards any leftovers
+// of previous runs in it. Creates the worktree if it doesn't exist.
+func checkoutWorktree(ctx context.Context, storeDir, worktreeDir, commit string) error {
+	if _, err := os.Stat(filepath.Join(worktreeDir, ".git")); err == nil {
+		cmdRunner := utils.NewCommandRunner(worktreeDir)
+		if output, err := cmdRunner.Run(ctx, "git", "checkout", "--quiet", "--force", "--detach", commit); err != nil {
+			return errors.Wrapf(err, "Failed to checkout commit '%s': %s", commit, output)
+		}
+
+		if output, err := cmdRunner.Run(ctx, "git", "clean", "-ffdx"); err != nil {
+			return errors.Wrapf(err, "Failed to clean worktree '%s': %s", worktreeDir, output)
+		}
+
+		return nil
+	}
+
+	if err := os.RemoveAll(worktreeDir); err != nil {
+		return errors.Wrapf(err, "Failed to remove worktree '%s'", worktreeDir)
+	}
+
+	cmdRunner := utils.NewCommandRunner(storeDir)
+	if output, err := cmdRunner.Run(ctx, "git", "worktree", "prune"); err != nil {
+		return errors.Wrapf(err, "Failed to prune worktrees: %s", output)
+	}
+
+	output, err := cmdRunner.Run(ctx, "git", "worktree", "add", "--quiet", "--force", "--detach", worktreeDir, commit)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to add worktree '%s': %s", worktreeDir, output)
+	}
+
+	return nil
+}
+
+// linkClonePath links fixedClonePath to the clone, replacing a previous link, or a clone of earlier versions
+// which cloned into fixedClonePath itself
+func linkClonePath(clonePath, fixedClonePath string) error {
+	if info, err := os.Lstat(fixedClonePath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(fixedClonePath); err != nil {
+			return errors.Wrapf(err, "Failed to remove symlink '%s'", fixedClonePath)
+		}
+	} else if err == nil && info.IsDir() {
+		if !isCloneDir(fixedClonePath) {
+			return errors.Errorf("Clone path '%s' already exists and is not a clone", fixedClonePath)
+		}
+
+		if err := os.RemoveAll(fixedClonePath); err != nil {
+			return errors.Wrapf(err, "Failed to remove the clone in '%s'", fixedClonePath)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fixedClonePath), 0750); err != nil {
+		return errors.Wrapf(err, "Failed to create the parent dir of '%s'", fixedClonePath)
+	}
+
+	if err := os.Symlink(clonePath, fixedClonePath); err != nil {
+		return errors.Wrapf(err, "Failed to create symlink '%s' for '%s'", clonePath, fixedClonePath)
+	}
+
+	return nil
+}
+
+// isCloneDir whether dir is a clone of a repository, or an empty directory that a clone was interrupted in
+func isCloneDir(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return true
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	return err == nil && len(entries) == 0
+}
+
+// dirName returns a readable, unique directory name for the given value
+func dirName(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	name := validPathRegexp.ReplaceAllString(value, "_")
+	if len(name) > 64 {
+		name = name[len(name)-64:]
+	}
+
+	return name + "-" + hex.EncodeToString(hash[:])[:12]
+}
@@ -9,10 +9,12 @@ import (
 	"github.com/pkg/errors"
 )
 
-func RunHook(ctx context.Context, hook string) error {
-	log.Infof("Running post hook '%s'", hook)
-	log.IncreasePadding()
-	defer log.DecreasePadding()
+// RunHook runs the given hook command in dir and returns its combined output
+func RunHook(ctx context.Context, dir string, hook string) (string, error) {
+	logger := log.FromContext(ctx)
+	logger.Infof("Running post hook '%s'", hook)
+	logger.IncreasePadding()
+	defer logger.DecreasePadding()
 
 	cmdParts := strings.Split(hook, " ")
 	args := []string{}
@@ -20,15 +22,17 @@ func RunHook(ctx context.Context, hook string) error {
 		args = append(args, cmdParts[1:]...)
 	}
 
-	outBytes, err := exec.CommandContext(ctx, cmdParts[0], args...).CombinedOutput() // nolint:gosec
+	cmd := exec.CommandContext(ctx, cmdParts[0], args...) // nolint:gosec
+	cmd.Dir = dir
+	outBytes, err := cmd.CombinedOutput()
 	out := string(outBytes)
 	if err != nil {
-		return errors.Wrapf(err, "Failed to run post hook '%s': %s", hook, out)
+		return out, errors.Wrapf(err, "Failed to run post hook '%s': %s", hook, out)
 	}
 
 	if out != "" {
-		log.Infof("Output: %s", out)
+		logger.Infof("Output: %s", out)
 	}
 
-	return nil
+	return out, nil
 }
@@ -0,0 +1,348 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+const (
+	// similarityThreshold the minimal similarity of a project file to a source file with another name to match it
+	similarityThreshold = 0.5
+)
+
+var (
+	// templateExtensions the extensions of source files that are removed to find the project files they match
+	templateExtensions = []string{".tpl", ".tmpl"}
+	// paramsFilenames the names of the params files at the root of the source that templated targets are rendered with
+	paramsFilenames = []string{"params.yaml", "params.yml", "params.json", "params.toml"}
+)
+
+type InitOpts struct {
+	DryRun  bool
+	Confirm bool
+	// Force overwrites the project config if it already exists
+	Force bool
+}
+
+// Init scaffolds the project config of the project residing in projectDir from a shared source, which is either a
+// repository URL or a local directory. Every source file with blocks is matched with a project file by its path, or
+// by the similarity of their contents, and becomes a target. The blocks that the project file is missing are marked
+// around the lines that are the most similar to them. Returns the project config.
+func Init(
+	ctx context.Context,
+	projectDir, sourceArg string,
+	cloner git.Cloner,
+	opts *InitOpts,
+) (*config.ProjectConfig, error) {
+	logger := log.FromContext(ctx)
+
+	cfgPath := filepath.Join(projectDir, config.DefaultProjectConfigFilename)
+	if _, err := os.Stat(cfgPath); err == nil && !opts.Force {
+		return nil, errors.Errorf("Project config '%s' already exists. Use --force to overwrite it", cfgPath)
+	}
+
+	source, err := newInitSource(projectDir, sourceArg)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceDir, err := ResolveSourcePath(ctx, source, projectDir, cloner)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to resolve source '%s'", source.String())
+	}
+
+	sourceFiles, err := listFiles(sourceDir, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list the files of source '%s'", source.String())
+	}
+
+	projectFiles, err := listFiles(projectDir, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list the files of the project")
+	}
+	// The source may reside in the project
+	projectFiles = lo.Filter(projectFiles, func(file string, _ int) bool {
+		return !strings.HasPrefix(filepath.Join(projectDir, file), sourceDir+string(filepath.Separator))
+	})
+
+	paramsFile, hasParams := lo.Find(sourceFiles, func(file string) bool { return lo.Contains(paramsFilenames, file) })
+
+	cfg := &config.ProjectConfig{}
+	// The project files that are matched, by the source files that they are matched with
+	matchedFiles := map[string]string{}
+	// The contents of the project files with the accepted block markers, that are written once the config is valid
+	markedFiles := map[string]string{}
+	for _, sourceFile := range sourceFiles {
+		sourceBlocks, err := parseBlocksFromFile(filepath.Join(sourceDir, sourceFile), nil, nil)
+		if err != nil {
+			logger.WithError(err).Debugf("Source '%s': Failed to parse blocks. Skipping", sourceFile)
+
+			continue
+		}
+		sourceBlocks = lo.Filter(sourceBlocks, func(block *Block, _ int) bool { return block.Name != "" })
+		if len(sourceBlocks) == 0 {
+			continue
+		}
+
+		targetFile := matchProjectFile(sourceDir, sourceFile, projectDir, projectFiles)
+		if targetFile == "" {
+			logger.Infof("Source '%s': No matching project file found. Skipping", sourceFile)
+
+			continue
+		}
+		if matchedSource, ok := matchedFiles[targetFile]; ok {
+			logger.Warnf("Source '%s': Project file '%s' is already matched by source '%s'. Skipping",
+				sourceFile, targetFile, matchedSource)
+
+			continue
+		}
+		matchedFiles[targetFile] = sourceFile
+		logger.Infof("Source '%s': Matched project file '%s'", sourceFile, targetFile)
+
+		markedContent, err := insertBlockMarkers(ctx, projectDir, targetFile, sourceBlocks, opts)
+		if err != nil {
+			return nil, err
+		}
+		if markedContent != "" {
+			markedFiles[targetFile] = markedContent
+		}
+
+		target := config.Target{Path: targetFile, Source: source}
+		target.Source.Path = path.Join(source.Path, sourceFile)
+		templated := lo.SomeBy(sourceBlocks, func(block *Block) bool { return strings.Contains(block.Render(), "{{") })
+		if templated && hasParams {
+			paramsSource := source
+			paramsSource.Path = path.Join(source.Path, paramsFile)
+			target.Params = []config.Params{{Source: paramsSource}}
+		}
+		cfg.Targets = append(cfg.Targets, target)
+	}
+
+	if len(cfg.Targets) == 0 {
+		return nil, errors.Errorf("No project files match the files with blocks of source '%s'", source.String())
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Wrap(err, "Failed to validate project config")
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg); err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal project config")
+	}
+
+	logger.Infof("Project config '%s':\n%s", config.DefaultProjectConfigFilename, buf.String())
+	if opts.DryRun {
+		logger.Info("In dry-run mode - Not writing the project config")
+
+		return cfg, nil
+	}
+
+	for _, target := range cfg.Targets {
+		if markedContent, ok := markedFiles[target.Path]; ok {
+			if err := utils.WriteStringToFile(filepath.Join(projectDir, target.Path), markedContent); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := utils.WriteStringToFile(cfgPath, buf.String()); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// newInitSource returns the source of a repository URL (including the scp-like `git@host:org/repo.git`), or of a
+// local directory relative to the project directory
+func newInitSource(projectDir, sourceArg string) (config.Source, error) {
+	if repository := config.RepositoryURI(sourceArg); repository.IsRemote() {
+		return config.Source{Repository: repository}, nil
+	}
+
+	absPath, err := filepath.Abs(sourceArg)
+	if err != nil {
+		return config.Source{}, errors.Wrapf(err, "Failed to get absolute path for '%s'", sourceArg)
+	}
+
+	relPath, err := filepath.Rel(projectDir, absPath)
+	if err != nil {
+		return config.Source{}, errors.Wrapf(err, "Failed to get the path of '%s' relative to the project", sourceArg)
+	}
+
+	return config.Source{Path: filepath.ToSlash(relPath)}, nil
+}
+
+// matchProjectFile returns the project file that matches the source file: the one with the same path (without a
+// template extension), or else the most similar one of the files with the same name, or of the files with the same
+// extension if they are similar enough. Returns an empty string if there is no match.
+func matchProjectFile(sourceDir, sourceFile, projectDir string, projectFiles []string) string {
+	name := sourceFile
+	for _, ext := range templateExtensions {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if lo.Contains(projectFiles, name) {
+		return name
+	}
+
+	baseName := path.Base(name)
+	threshold := 0.0
+	candidates := lo.Filter(projectFiles, func(file string, _ int) bool { return path.Base(file) == baseName })
+	if len(candidates) == 0 {
+		threshold = similarityThreshold
+		candidates = lo.Filter(projectFiles, func(file string, _ int) bool {
+			return path.Ext(baseName) != "" && path.Ext(file) == path.Ext(baseName)
+		})
+	}
+
+	sourceContent, err := os.ReadFile(filepath.Join(sourceDir, sourceFile))
+	if err != nil {
+		return ""
+	}
+	sourceLines := trimLines(fileLines(sourceContent))
+
+	best, bestRatio := "", threshold
+	for _, candidate := range candidates {
+		content, err := os.ReadFile(filepath.Join(projectDir, candidate))
+		if err != nil {
+			continue
+		}
+
+		ratio := difflib.NewMatcherWithJunk(sourceLines, trimLines(fileLines(content)), false, nil).Ratio()
+		if ratio > bestRatio || (best == "" && ratio == bestRatio) {
+			best, bestRatio = candidate, ratio
+		}
+	}
+
+	return best
+}
+
+// insertBlockMarkers proposes to mark the source blocks that the target file is missing around the lines that are
+// the most similar to them. Returns the content of the target file with the markers if the user confirms them, or an
+// empty string otherwise. The content isn't written, so that nothing changes if the project config turns out invalid.
+func insertBlockMarkers(
+	ctx context.Context,
+	projectDir, targetFile string,
+	sourceBlocks Blocks,
+	opts *InitOpts,
+) (string, error) {
+	logger := log.FromContext(ctx)
+	targetPath := filepath.Join(projectDir, targetFile)
+
+	targetBlocks, err := parseBlocksFromFile(targetPath, nil, nil)
+	if err != nil {
+		logger.WithError(err).Warnf("Target '%s': Failed to parse blocks. Add the block markers manually", targetFile)
+
+		return "", nil
+	}
+	lines := strings.Split(targetBlocks.Render(), "\n")
+
+	type region struct {
+		name       string
+		start, end int
+	}
+	regions := []region{}
+	for _, block := range sourceBlocks {
+		if targetBlocks.find(block.Name) != nil {
+			continue
+		}
+
+		start, end, ok := findSimilarRegion(lines, block.Lines[1:len(block.Lines)-1])
+		if !ok || lo.SomeBy(regions, func(r region) bool { return start < r.end && r.start < end }) {
+			logger.Warnf("Target '%s': No lines are similar to block '%s'. Add its markers manually",
+				targetFile, block.Name)
+
+			continue
+		}
+
+		regions = append(regions, region{name: block.Name, start: start, end: end})
+	}
+
+	if len(regions) == 0 {
+		return "", nil
+	}
+
+	// Insert the markers from the bottom up, to keep the indexes of the regions above
+	sort.Slice(regions, func(i, j int) bool { return regions[i].start > regions[j].start })
+	markedLines := append([]string{}, lines...)
+	for _, r := range regions {
+		line := markedLines[r.start]
+		startMarker, endMarker := newMarkerLines(targetFile, r.name, line[:len(line)-len(strings.TrimLeft(line, " \t"))])
+		markedLines = append(markedLines[:r.end], append([]string{endMarker}, markedLines[r.end:]...)...)
+		markedLines = append(markedLines[:r.start], append([]string{startMarker}, markedLines[r.start:]...)...)
+	}
+
+	if _, err := parseBlocksFromLines(markedLines, newMarkerParser(targetFile, nil)); err != nil {
+		logger.WithError(err).Warnf("Target '%s': The proposed block markers are invalid. Add them manually",
+			targetFile)
+
+		return "", nil
+	}
+
+	logger.Infof("Target '%s': Proposed block markers:\n%s\n", targetFile, linesDiff(lines, markedLines))
+	if opts.DryRun {
+		return "", nil
+	}
+
+	question := fmt.Sprintf("Do you want to insert the above block markers into '%s'?", targetFile)
+	answer, err := utils.PromptUserYesNoQuestion(question, opts.Confirm)
+	if err != nil {
+		return "", err
+	}
+	if !answer {
+		logger.Infof("Target '%s': Skipped inserting block markers", targetFile)
+
+		return "", nil
+	}
+
+	return strings.Join(markedLines, "\n"), nil
+}
+
+// findSimilarRegion returns the range of the lines that is the most similar to the content lines, comparing them
+// without their indentation. The range is extended by the content lines that were not found before the first match
+// and after the last one (e.g. templated lines). Returns false if less than half of the content lines are found.
+func findSimilarRegion(lines, content []string) (int, int, bool) {
+	start, end, matched := -1, -1, 0
+	contentStart, contentEnd := 0, 0
+	trimmedContent := trimLines(content)
+	for _, match := range difflib.NewMatcherWithJunk(trimmedContent, trimLines(lines), false, nil).GetMatchingBlocks() {
+		// Matches of empty lines alone could stretch the range far away from the content
+		if lo.EveryBy(trimmedContent[match.A:match.A+match.Size], func(line string) bool { return line == "" }) {
+			continue
+		}
+
+		if start == -1 {
+			start, contentStart = match.B, match.A
+		}
+		end, contentEnd = match.B+match.Size, match.A+match.Size
+		matched += match.Size
+	}
+
+	if len(content) == 0 || matched*2 < len(content) {
+		return 0, 0, false
+	}
+
+	return lo.Max([]int{0, start - contentStart}), lo.Min([]int{len(lines), end + len(content) - contentEnd}), true
+}
+
+func trimLines(lines []string) []string {
+	return lo.Map(lines, func(line string, _ int) string { return strings.TrimSpace(line) })
+}
@@ -0,0 +1,156 @@
+package pkg_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/cmd/testutils"
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
+	"github.com/ilaif/goplicate/pkg/mocks"
+)
+
+func TestInit(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"shared/.eslintrc.js.tpl": "module.exports = {\n" +
+			"  // goplicate-start:rules\n" +
+			"  indent: ['error', {{ .indent }}],\n" +
+			"  quotes: ['error', 'double'],\n" +
+			"  semi: ['error', 'always'],\n" +
+			"  // goplicate-end:rules\n" +
+			"}\n",
+		"shared/params.yaml": "indent: 2\n",
+		"shared/ci/build.yml": "# goplicate-start:steps\n" +
+			"steps:\n" +
+			"  - run: make lint\n" +
+			"  - run: make test\n" +
+			"# goplicate-end:steps\n",
+		"project/.eslintrc.js": "module.exports = {\n" +
+			"  extends: 'eslint:recommended',\n" +
+			"  indent: ['error', 4],\n" +
+			"  quotes: ['error', 'double'],\n" +
+			"  semi: ['error', 'always'],\n" +
+			"}\n",
+		"project/.github/workflows/ci.yml": "name: ci\n" +
+			"steps:\n" +
+			"  - run: make lint\n" +
+			"  - run: make test\n",
+		"project/README.md": "# project\n",
+	}
+	for name, content := range files {
+		r.NoError(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0750))
+		r.NoError(os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	projectDir := filepath.Join(dir, "project")
+
+	cfg, err := pkg.Init(context.TODO(), projectDir, filepath.Join(dir, "shared"), &mocks.ClonerMock{},
+		&pkg.InitOpts{Confirm: true})
+	r.NoError(err)
+	r.Equal([]config.Target{
+		{
+			Path:   ".eslintrc.js",
+			Source: config.Source{Path: "../shared/.eslintrc.js.tpl"},
+			Params: []config.Params{{Source: config.Source{Path: "../shared/params.yaml"}}},
+		},
+		{
+			Path:   ".github/workflows/ci.yml",
+			Source: config.Source{Path: "../shared/ci/build.yml"},
+		},
+	}, cfg.Targets)
+
+	loadedCfg, err := config.LoadProjectConfig(projectDir)
+	r.NoError(err)
+	r.Equal(cfg.Targets, loadedCfg.Targets)
+
+	content, err := os.ReadFile(filepath.Join(projectDir, ".eslintrc.js"))
+	r.NoError(err)
+	r.Equal("module.exports = {\n"+
+		"  extends: 'eslint:recommended',\n"+
+		"  // goplicate-start:rules\n"+
+		"  indent: ['error', 4],\n"+
+		"  quotes: ['error', 'double'],\n"+
+		"  semi: ['error', 'always'],\n"+
+		"  // goplicate-end:rules\n"+
+		"}\n", string(content))
+
+	content, err = os.ReadFile(filepath.Join(projectDir, ".github/workflows/ci.yml"))
+	r.NoError(err)
+	r.Equal("name: ci\n# goplicate-start:steps\nsteps:\n  - run: make lint\n  - run: make test\n"+
+		"# goplicate-end:steps\n", string(content))
+
+	_, err = pkg.Init(context.TODO(), projectDir, filepath.Join(dir, "shared"), &mocks.ClonerMock{},
+		&pkg.InitOpts{Confirm: true})
+	r.ErrorContains(err, "already exists")
+}
+
+// dirCloner a cloner that "clones" every repository into the same directory
+type dirCloner string
+
+func (c dirCloner) Clone(context.Context, string, git.Ref, string) (string, error) {
+	return string(c), nil
+}
+
+func (c dirCloner) Close() {}
+
+func TestInit_DuplicateMatches(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"shared/ci.yml":     "# goplicate-start:steps\nsteps: []\n# goplicate-end:steps\n",
+		"shared/ci.yml.tpl": "# goplicate-start:steps\nsteps: {{ .steps }}\n# goplicate-end:steps\n",
+		"project/ci.yml":    "# goplicate-start:steps\nsteps: [local]\n# goplicate-end:steps\n",
+	}
+	for name, content := range files {
+		r.NoError(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0750))
+		r.NoError(os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	projectDir := filepath.Join(dir, "project")
+
+	cfg, err := pkg.Init(context.TODO(), projectDir, filepath.Join(dir, "shared"), &mocks.ClonerMock{},
+		&pkg.InitOpts{Confirm: true})
+	r.NoError(err)
+	r.Equal([]config.Target{{Path: "ci.yml", Source: config.Source{Path: "../shared/ci.yml"}}}, cfg.Targets)
+}
+
+func TestInit_RemoteSources(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	projectContent := "name: ci\nsteps: [lint]\n"
+	files := map[string]string{
+		"shared/ci.yml":  "name: ci\n# goplicate-start:steps\nsteps: [lint]\n# goplicate-end:steps\n",
+		"project/ci.yml": projectContent,
+	}
+	for name, content := range files {
+		r.NoError(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0750))
+		r.NoError(os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	projectDir := filepath.Join(dir, "project")
+	cloner := dirCloner(filepath.Join(dir, "shared"))
+
+	// The block markers aren't inserted if the project config is invalid
+	_, err := pkg.Init(context.TODO(), projectDir, "https://example.com/%zz", cloner, &pkg.InitOpts{Confirm: true})
+	r.ErrorContains(err, "Failed to validate project config")
+	content, err := os.ReadFile(filepath.Join(projectDir, "ci.yml"))
+	r.NoError(err)
+	r.Equal(projectContent, string(content))
+
+	cfg, err := pkg.Init(context.TODO(), projectDir, "git@example.com:org/shared.git", cloner,
+		&pkg.InitOpts{Confirm: true})
+	r.NoError(err)
+	r.Equal([]config.Target{{
+		Path:   "ci.yml",
+		Source: config.Source{Repository: "git@example.com:org/shared.git", Path: "ci.yml"},
+	}}, cfg.Targets)
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "ci.yml"),
+		"# goplicate-start:steps\nsteps: [lint]\n# goplicate-end:steps\n")
+}
@@ -0,0 +1,156 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+
+	"github.com/ilaif/goplicate/pkg/config"
+)
+
+// insertMissingBlocks inserts the source blocks of the target's `insert` that are missing in the target blocks,
+// and returns their results. If interactive is set, the user approves the insertion of every block.
+func insertMissingBlocks(
+	ctx context.Context,
+	target config.Target,
+	targetBlocks *Blocks,
+	sourceBlocks Blocks,
+	interactive bool,
+) ([]*BlockResult, error) {
+	logger := log.FromContext(ctx)
+
+	insertedBlocks := []*BlockResult{}
+	for _, insert := range target.Insert {
+		if targetBlocks.Get(insert.Block) != nil || !target.SyncsBlock(insert.Block) {
+			continue
+		}
+
+		sourceBlock := sourceBlocks.Get(insert.Block)
+		if sourceBlock == nil {
+			logger.Warnf("Target '%s': Block '%s' to insert not found in source. Skipping", target.Path, insert.Block)
+
+			continue
+		}
+
+		diff := linesDiff([]string{}, sourceBlock.Lines)
+		logger.Infof("Target '%s': Block '%s' is missing and needs to be inserted. Content:\n%s\n",
+			target.Path, insert.Block, diff)
+
+		if interactive {
+			answer, err := approveChange(target.Path, fmt.Sprintf("insert block '%s'", insert.Block))
+			if err != nil {
+				return nil, err
+			}
+			if !answer {
+				logger.Infof("Target '%s': Block '%s' skipped", target.Path, insert.Block)
+				insertedBlocks = append(insertedBlocks, &BlockResult{Name: insert.Block, Status: StatusSkipped})
+
+				continue
+			}
+		}
+
+		index, found, err := targetBlocks.anchorIndex(insert)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			logger.Warnf("Target '%s': Anchor of block '%s' not found. Inserting it at the end of the file",
+				target.Path, insert.Block)
+			index = targetBlocks.endIndex()
+		}
+
+		block := &Block{}
+		*block = *sourceBlock
+		*targetBlocks = append((*targetBlocks)[:index], append(Blocks{block}, (*targetBlocks)[index:]...)...)
+
+		insertedBlocks = append(insertedBlocks, &BlockResult{
+			Name:      block.Name,
+			Status:    StatusOutdated,
+			StartLine: targetBlocks.startLine(index),
+			Diff:      linesUnifiedDiff([]string{}, block.Lines),
+		})
+	}
+
+	return insertedBlocks, nil
+}
+
+// anchorIndex returns the index in the blocks to insert the block of the insert at: after the block `after`,
+// before the first line that matches `before` (splitting its unnamed block if needed), or at the end.
+// Returns false if the anchor wasn't found.
+func (b *Blocks) anchorIndex(insert config.Insert) (int, bool, error) {
+	switch {
+	case insert.After != "":
+		for i, block := range *b {
+			if block.Name == insert.After {
+				return i + 1, true, nil
+			}
+		}
+
+		return 0, false, nil
+	case insert.Before != "":
+		regex, err := regexp.Compile(insert.Before)
+		if err != nil {
+			return 0, false, errors.Wrapf(err, "Failed to compile regex '%s'", insert.Before)
+		}
+
+		for i, block := range *b {
+			for j, line := range block.Lines {
+				if !regex.MatchString(line) {
+					continue
+				}
+
+				if block.Name != "" || j == 0 {
+					// Named blocks are not split, so the block is inserted before them
+					return i, true, nil
+				}
+
+				b.split(i, j)
+
+				return i + 1, true, nil
+			}
+		}
+
+		return 0, false, nil
+	default:
+		return b.endIndex(), true, nil
+	}
+}
+
+// endIndex returns the index in the blocks to insert a block at the end of the file, before its trailing newline
+func (b *Blocks) endIndex() int {
+	if len(*b) == 0 {
+		return 0
+	}
+
+	last := len(*b) - 1
+	lastBlock := (*b)[last]
+	if lastBlock.Name != "" || lastBlock.Lines[len(lastBlock.Lines)-1] != "" {
+		return len(*b)
+	}
+
+	if len(lastBlock.Lines) == 1 {
+		return last
+	}
+
+	b.split(last, len(lastBlock.Lines)-1)
+
+	return last + 1
+}
+
+// split splits the unnamed block at index i into two unnamed blocks, where the second one starts at line j
+func (b *Blocks) split(i, j int) {
+	block := (*b)[i]
+	rest := &Block{Lines: block.Lines[j:]}
+	block.Lines = block.Lines[:j]
+
+	*b = append((*b)[:i+1], append(Blocks{rest}, (*b)[i+1:]...)...)
+}
+
+// startLine returns the number of the first line of the block at index i
+func (b *Blocks) startLine(i int) int {
+	return 1 + lo.SumBy((*b)[:i], func(block *Block) int { return len(block.Lines) })
+}
@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
+)
+
+// lockingCloner wraps a cloner to record the commit that every cloned repository was resolved to.
+// If locked is set, repositories are cloned at the commits recorded in the lock file instead.
+type lockingCloner struct {
+	git.Cloner
+	lockFile *config.LockFile
+	locked   bool
+
+	mu       sync.Mutex
+	resolved *config.LockFile
+}
+
+func newLockingCloner(cloner git.Cloner, lockFile *config.LockFile, locked bool) *lockingCloner {
+	return &lockingCloner{
+		Cloner:   cloner,
+		lockFile: lockFile,
+		locked:   locked,
+		resolved: &config.LockFile{},
+	}
+}
+
+func (c *lockingCloner) Clone(ctx context.Context, uri string, ref git.Ref, fixedClonePath string) (string, error) {
+	lockRef := ref.String()
+	if c.locked {
+		commit := c.lockFile.Get(uri, lockRef)
+		if commit == "" {
+			return "", errors.Errorf("Repository '%s' (ref '%s') is not locked in '%s'. Run `goplicate update` to lock it",
+				uri, lockRef, config.LockFilename)
+		}
+
+		log.FromContext(ctx).Debugf("Using locked commit '%s' of repository '%s'", commit, uri)
+		ref = git.Ref{Commit: commit}
+	}
+
+	clonePath, err := c.Cloner.Clone(ctx, uri, ref, fixedClonePath)
+	if err != nil {
+		return "", err
+	}
+
+	commit, err := git.ResolveCommit(ctx, clonePath)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resolved.Set(uri, lockRef, commit)
+
+	return clonePath, nil
+}
+
+// Update resolves the latest commits of all source and params repositories of the project residing in projectDir,
+// and records them in its lock file
+func Update(ctx context.Context, projectDir string, cloner git.Cloner) (*config.LockFile, error) {
+	logger := log.FromContext(ctx)
+
+	cfg, err := config.LoadProjectConfig(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	lockFile, err := config.LoadLockFile(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	lockingCloner := newLockingCloner(cloner, nil, false)
+
+	targets := cfg.Targets
+	if cfg.SyncConfig != nil {
+		targets = append([]config.Target{*cfg.SyncConfig}, targets...)
+	}
+
+	for _, target := range targets {
+		sources := []config.Source{target.Source}
+		for _, params := range target.Params {
+			if !params.Inline() {
+				sources = append(sources, params.Source)
+			}
+		}
+
+		for _, source := range sources {
+			if _, err := ResolveSourcePath(ctx, source, projectDir, lockingCloner); err != nil {
+				return nil, errors.Wrapf(err, "Failed to resolve source '%s'", source.String())
+			}
+		}
+	}
+
+	if lockingCloner.resolved.Equal(lockFile) {
+		logger.Debugf("The lock file '%s' is up to date", config.LockFilename)
+	} else if err := lockingCloner.resolved.Save(projectDir); err != nil {
+		return nil, err
+	}
+
+	for _, locked := range lockingCloner.resolved.Repositories {
+		logger.Infof("Locked '%s' (ref '%s') to commit '%s'", locked.Repository, locked.Ref, locked.Commit)
+	}
+
+	return lockingCloner.resolved, nil
+}
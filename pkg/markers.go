@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+
+	"github.com/ilaif/goplicate/pkg/config"
+)
+
+// commentStyle a way of writing a block comment: a prefix, and a suffix that must close it (if any)
+type commentStyle struct {
+	prefix string
+	suffix string
+}
+
+var (
+	hashComment      = commentStyle{prefix: "#"}
+	slashComment     = commentStyle{prefix: "//"}
+	cBlockComment    = commentStyle{prefix: "/*", suffix: "*/"}
+	dashComment      = commentStyle{prefix: "--"}
+	htmlComment      = commentStyle{prefix: "<!--", suffix: "-->"}
+	semicolonComment = commentStyle{prefix: ";"}
+	percentComment   = commentStyle{prefix: "%"}
+	quoteComment     = commentStyle{prefix: "'"}
+	jinjaComment     = commentStyle{prefix: "{#", suffix: "#}"}
+
+	// legacyHTMLComment the `<--` comments of earlier versions, accepted wherever `<!--` comments are.
+	// Deprecated: use `<!-- -->` instead.
+	legacyHTMLComment = commentStyle{prefix: "<--"}
+
+	// fallbackCommentStyles the comment styles of files with unknown extensions, which are the ones that every
+	// file had in earlier versions
+	fallbackCommentStyles = []commentStyle{hashComment, slashComment, cBlockComment, dashComment, legacyHTMLComment}
+
+	cLikeCommentStyles = []commentStyle{slashComment, cBlockComment}
+	htmlCommentStyles  = []commentStyle{htmlComment, legacyHTMLComment}
+
+	// commentStylesByExtension the comment styles of files by their extension, or by their name if they
+	// don't have one
+	commentStylesByExtension = map[string][]commentStyle{
+		".yaml": {hashComment}, ".yml": {hashComment}, ".toml": {hashComment}, ".py": {hashComment},
+		".sh": {hashComment}, ".bash": {hashComment}, ".zsh": {hashComment}, ".rb": {hashComment},
+		".r": {hashComment}, ".pl": {hashComment}, ".ps1": {hashComment}, ".properties": {hashComment},
+		".env": {hashComment}, "Dockerfile": {hashComment}, "Makefile": {hashComment}, ".mk": {hashComment},
+		".tf": {hashComment, slashComment, cBlockComment}, ".hcl": {hashComment, slashComment, cBlockComment},
+
+		".js": cLikeCommentStyles, ".cjs": cLikeCommentStyles, ".mjs": cLikeCommentStyles,
+		".jsx": cLikeCommentStyles, ".ts": cLikeCommentStyles, ".tsx": cLikeCommentStyles,
+		".go": cLikeCommentStyles, ".java": cLikeCommentStyles, ".kt": cLikeCommentStyles,
+		".scala": cLikeCommentStyles, ".c": cLikeCommentStyles, ".h": cLikeCommentStyles,
+		".cpp": cLikeCommentStyles, ".hpp": cLikeCommentStyles, ".cs": cLikeCommentStyles,
+		".rs": cLikeCommentStyles, ".swift": cLikeCommentStyles, ".dart": cLikeCommentStyles,
+		".scss": cLikeCommentStyles, ".less": cLikeCommentStyles, ".proto": cLikeCommentStyles,
+		".css": {cBlockComment},
+
+		".sql": {dashComment, cBlockComment}, ".lua": {dashComment}, ".hs": {dashComment},
+
+		".html": htmlCommentStyles, ".htm": htmlCommentStyles, ".xml": htmlCommentStyles, ".svg": htmlCommentStyles,
+		".md": htmlCommentStyles, ".vue": {htmlComment, legacyHTMLComment, slashComment, cBlockComment},
+
+		".lisp": {semicolonComment}, ".el": {semicolonComment}, ".clj": {semicolonComment},
+		".scm": {semicolonComment}, ".asm": {semicolonComment}, ".ini": {semicolonComment, hashComment},
+
+		".erl": {percentComment}, ".hrl": {percentComment}, ".tex": {percentComment},
+		".sty": {percentComment},
+
+		".vb": {quoteComment}, ".vbs": {quoteComment}, ".bas": {quoteComment},
+
+		".j2": {jinjaComment, hashComment}, ".jinja": {jinjaComment, hashComment},
+		".jinja2": {jinjaComment, hashComment},
+	}
+)
+
+// markerParser parses a line into the params of a block comment, or returns nil if it's not a block comment
+type markerParser func(line string) (*blockParams, error)
+
+// newMarkerParser returns the parser of the block comments of the file: the custom markers if given, or
+// the comment styles of the file's extension
+func newMarkerParser(filename string, markers *config.Markers) markerParser {
+	if markers != nil {
+		return newCustomMarkerParser(markers)
+	}
+
+	styles, ok := commentStylesOf(filename)
+	if !ok {
+		styles = fallbackCommentStyles
+	}
+
+	return newCommentMarkerParser(styles)
+}
+
+// commentStylesOf returns the comment styles of the file by its extension (or name), or false if they are unknown
+func commentStylesOf(filename string) ([]commentStyle, bool) {
+	styles, ok := commentStylesByExtension[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		styles, ok = commentStylesByExtension[filepath.Base(filename)]
+	}
+
+	return styles, ok
+}
+
+// newMarkerLines returns the start and end block comments of the block in the first comment style of the file
+// (or `#` if it's unknown), indented by indent
+func newMarkerLines(filename, name, indent string) (string, string) {
+	style := hashComment
+	if styles, ok := commentStylesOf(filename); ok {
+		style = styles[0]
+	}
+
+	suffix := ""
+	if style.suffix != "" {
+		suffix = " " + style.suffix
+	}
+
+	return indent + style.prefix + " goplicate-start:" + name + suffix,
+		indent + style.prefix + " goplicate-end:" + name + suffix
+}
+
+// newCommentMarkerParser returns a parser of the block comments of the given styles.
+// Block comments are of the forms `goplicate-start|end(...params...)` and `goplicate-start|end:<name>`,
+// and must be closed with the suffix of their style (e.g. `-->`).
+func newCommentMarkerParser(styles []commentStyle) markerParser {
+	prefixes := lo.Map(styles, func(style commentStyle, _ int) string { return regexp.QuoteMeta(style.prefix) })
+
+	// regex decomposition:
+	// 1. identifying comments, e.g. (#|\/\/)
+	// 2. goplicate block format: goplicate_start|end(...params...) or goplicate-start:<name>
+	regex := regexp.MustCompile(`(` + strings.Join(prefixes, "|") +
+		`)\s*goplicate([_\-](start|end))?(\(([^)]*)\)|:(\S+))`)
+
+	return func(line string) (*blockParams, error) {
+		matches := regex.FindStringSubmatch(line)
+		if matches == nil {
+			return nil, nil
+		}
+
+		style, _ := lo.Find(styles, func(style commentStyle) bool { return style.prefix == matches[1] })
+		if style.suffix != "" && !strings.HasSuffix(strings.TrimSpace(line), style.suffix) {
+			return nil, errors.Errorf("Block comment '%s' must be closed with '%s'", strings.TrimSpace(line),
+				style.suffix)
+		}
+
+		paramsStr := matches[5]
+		if matches[6] != "" {
+			// Assume the format is "goplicate-start:<name>"
+			paramsStr = fmt.Sprintf("name=%s", strings.TrimSuffix(matches[6], style.suffix))
+		}
+
+		return parseBlockParams(matches[3], paramsStr)
+	}
+}
+
+// newCustomMarkerParser returns a parser of block comments that match the custom start and end patterns
+func newCustomMarkerParser(markers *config.Markers) markerParser {
+	toRegex := func(pattern string) *regexp.Regexp {
+		return regexp.MustCompile(strings.ReplaceAll(regexp.QuoteMeta(pattern),
+			regexp.QuoteMeta(config.MarkerNamePlaceholder), `(\S+)`))
+	}
+	startRegex, endRegex := toRegex(markers.Start), toRegex(markers.End)
+
+	return func(line string) (*blockParams, error) {
+		if matches := startRegex.FindStringSubmatch(line); matches != nil {
+			return &blockParams{name: matches[1], pos: PosStart}, nil
+		}
+
+		if matches := endRegex.FindStringSubmatch(line); matches != nil {
+			bp := &blockParams{pos: PosEnd}
+			if len(matches) > 1 {
+				bp.name = matches[1]
+			}
+
+			return bp, nil
+		}
+
+		return nil, nil
+	}
+}
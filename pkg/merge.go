@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"sort"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/samber/lo"
+)
+
+const (
+	conflictLocalMarker    = "<<<<<<< local"
+	conflictSeparator      = "======="
+	conflictUpstreamMarker = ">>>>>>> upstream"
+)
+
+// hunk a change of the base lines in the range [start, end) into other lines, made locally or upstream
+type hunk struct {
+	start, end int
+	lines      []string
+	upstream   bool
+}
+
+// threeWayMerge merges the changes that were made to the base lines upstream into the local lines.
+// Changes of both sides to the same (or adjacent) lines conflict, unless they are identical, and are marked with
+// git-style conflict markers. Returns the merged lines, and whether they have conflicts.
+func threeWayMerge(base, local, upstream []string) ([]string, bool) {
+	hunks := append(diffHunks(base, local, false), diffHunks(base, upstream, true)...)
+	sort.SliceStable(hunks, func(i, j int) bool { return hunks[i].start < hunks[j].start })
+
+	merged := []string{}
+	conflicted := false
+	pos := 0
+	for i := 0; i < len(hunks); {
+		// Group the hunks that overlap or touch each other
+		start, end := hunks[i].start, hunks[i].end
+		j := i + 1
+		for ; j < len(hunks) && hunks[j].start <= end; j++ {
+			end = lo.Max([]int{end, hunks[j].end})
+		}
+		group := hunks[i:j]
+		i = j
+
+		merged = append(merged, base[pos:start]...)
+		pos = end
+
+		localHunks := lo.Filter(group, func(h *hunk, _ int) bool { return !h.upstream })
+		upstreamHunks := lo.Filter(group, func(h *hunk, _ int) bool { return h.upstream })
+		localLines := applyHunks(base, start, end, localHunks)
+		upstreamLines := applyHunks(base, start, end, upstreamHunks)
+
+		switch {
+		case len(upstreamHunks) == 0 || linesEqual(localLines, upstreamLines):
+			merged = append(merged, localLines...)
+		case len(localHunks) == 0:
+			merged = append(merged, upstreamLines...)
+		default:
+			conflicted = true
+			merged = append(merged, conflictLocalMarker)
+			merged = append(merged, localLines...)
+			merged = append(merged, conflictSeparator)
+			merged = append(merged, upstreamLines...)
+			merged = append(merged, conflictUpstreamMarker)
+		}
+	}
+
+	return append(merged, base[pos:]...), conflicted
+}
+
+// diffHunks returns the changes that were made to the base lines
+func diffHunks(base, changed []string, upstream bool) []*hunk {
+	hunks := []*hunk{}
+	for _, op := range difflib.NewMatcherWithJunk(base, changed, false, nil).GetOpCodes() {
+		if op.Tag != 'e' {
+			hunks = append(hunks, &hunk{start: op.I1, end: op.I2, lines: changed[op.J1:op.J2], upstream: upstream})
+		}
+	}
+
+	return hunks
+}
+
+// applyHunks returns the base lines in the range [start, end) with the sorted hunks applied to them
+func applyHunks(base []string, start, end int, hunks []*hunk) []string {
+	lines := []string{}
+	pos := start
+	for _, h := range hunks {
+		lines = append(lines, base[pos:h.start]...)
+		lines = append(lines, h.lines...)
+		pos = h.end
+	}
+
+	return append(lines, base[pos:end]...)
+}
+
+func linesEqual(lines1, lines2 []string) bool {
+	if len(lines1) != len(lines2) {
+		return false
+	}
+
+	for i := range lines1 {
+		if lines1[i] != lines2[i] {
+			return false
+		}
+	}
+
+	return true
+}
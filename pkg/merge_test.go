@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThreeWayMerge(t *testing.T) {
+	a := assert.New(t)
+
+	lines := func(s string) []string { return strings.Split(s, "\n") }
+
+	tests := []struct {
+		name             string
+		base             string
+		local            string
+		upstream         string
+		expected         string
+		expectedConflict bool
+	}{
+		{
+			name:     "upstream changes only",
+			base:     "a\nb\nc",
+			local:    "a\nb\nc",
+			upstream: "a\nB\nc",
+			expected: "a\nB\nc",
+		},
+		{
+			name:     "local changes only",
+			base:     "a\nb\nc",
+			local:    "a\nb\nc\nlocal",
+			upstream: "a\nb\nc",
+			expected: "a\nb\nc\nlocal",
+		},
+		{
+			name:     "changes to different lines",
+			base:     "a\nb\nc\nd\ne",
+			local:    "A\nb\nc\nd\ne",
+			upstream: "a\nb\nc\nd\nE\nf",
+			expected: "A\nb\nc\nd\nE\nf",
+		},
+		{
+			name:     "identical changes",
+			base:     "a\nb\nc",
+			local:    "a\nB\nc",
+			upstream: "a\nB\nc",
+			expected: "a\nB\nc",
+		},
+		{
+			name:             "conflicting changes",
+			base:             "a\nb\nc",
+			local:            "a\nlocal\nc",
+			upstream:         "a\nupstream\nc",
+			expected:         "a\n<<<<<<< local\nlocal\n=======\nupstream\n>>>>>>> upstream\nc",
+			expectedConflict: true,
+		},
+	}
+
+	for _, test := range tests {
+		merged, conflict := threeWayMerge(lines(test.base), lines(test.local), lines(test.upstream))
+		a.Equal(test.expected, strings.Join(merged, "\n"), test.name)
+		a.Equal(test.expectedConflict, conflict, test.name)
+	}
+}
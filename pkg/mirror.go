@@ -0,0 +1,215 @@
+package pkg
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+const (
+	// FileBlockName the name of the block result that describes a change of a whole file
+	FileBlockName = "(file)"
+)
+
+// ExpandTarget returns a target per file of a mirror target, or the target itself if it doesn't mirror.
+// The files are the ones that exist in both the source directory and the target, along with the ones that only
+// exist in the source if they are created, and the ones that only exist in the target if they are deleted.
+func ExpandTarget(
+	ctx context.Context,
+	workdir string,
+	target config.Target,
+	cloner git.Cloner,
+) ([]config.Target, error) {
+	if target.Mirror == nil {
+		return []config.Target{target}, nil
+	}
+
+	sourceDir, err := ResolveSourcePath(ctx, target.Source, workdir, cloner)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to resolve source '%s'", target.Source.String())
+	}
+
+	targetDir, pattern := splitGlob(target.Path)
+
+	// A source directory that was removed has no files, so that its mirrored files can be deleted
+	sourceFiles := []string{}
+	if _, err := os.Stat(sourceDir); err == nil {
+		if sourceFiles, err = listFiles(sourceDir, pattern); err != nil {
+			return nil, errors.Wrapf(err, "Failed to list the files of source '%s'", target.Source.String())
+		}
+	} else {
+		log.FromContext(ctx).Debugf("Target '%s': Source '%s' doesn't exist", target.Path, target.Source.String())
+	}
+
+	targetFiles := []string{}
+	if _, err := os.Stat(filepath.Join(workdir, targetDir)); err == nil {
+		if targetFiles, err = listFiles(filepath.Join(workdir, targetDir), pattern); err != nil {
+			return nil, errors.Wrapf(err, "Failed to list the files of target '%s'", target.Path)
+		}
+	}
+
+	files := lo.Intersect(sourceFiles, targetFiles)
+	if target.Mirror.Create {
+		files = append(files, lo.Without(sourceFiles, targetFiles...)...)
+	}
+	if target.Mirror.Delete {
+		files = append(files, lo.Without(targetFiles, sourceFiles...)...)
+	}
+	sort.Strings(files)
+
+	log.FromContext(ctx).Debugf("Target '%s': Mirroring files %s", target.Path, files)
+
+	return lo.Map(files, func(file string, _ int) config.Target {
+		fileTarget := target
+		fileTarget.Path = path.Join(targetDir, file)
+		fileTarget.Source.Path = path.Join(target.Source.Path, file)
+
+		return fileTarget
+	}), nil
+}
+
+// runMirroredFile syncs the whole contents of a mirrored file, creating or deleting it if needed
+func runMirroredFile(
+	ctx context.Context,
+	target config.Target,
+	targetPath, sourcePath string,
+	result *TargetResult,
+	dryRun, confirm bool,
+) (*TargetResult, error) {
+	logger := log.FromContext(ctx)
+
+	targetContent, err := os.ReadFile(targetPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Wrapf(err, "Failed to read file '%s'", targetPath)
+	}
+	targetExists := err == nil
+
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Wrapf(err, "Failed to stat file '%s'", sourcePath)
+	}
+	sourceExists := err == nil
+
+	var sourceContent []byte
+	write := func() error {
+		if err := os.Remove(targetPath); err != nil {
+			return errors.Wrapf(err, "Failed to delete file '%s'", targetPath)
+		}
+
+		return nil
+	}
+	if sourceExists {
+		if sourceContent, err = utils.ReadFile(sourcePath); err != nil {
+			return nil, err
+		}
+
+		write = func() error {
+			if err := os.MkdirAll(filepath.Dir(targetPath), 0750); err != nil {
+				return errors.Wrapf(err, "Failed to create the parent dir of '%s'", targetPath)
+			}
+			if err := os.WriteFile(targetPath, sourceContent, sourceInfo.Mode().Perm()); err != nil {
+				return errors.Wrapf(err, "Failed to write to file '%s'", targetPath)
+			}
+
+			return nil
+		}
+	}
+
+	blockResult := &BlockResult{Name: FileBlockName, Status: StatusUpToDate, StartLine: 1}
+	result.Blocks = append(result.Blocks, blockResult)
+
+	targetLines, sourceLines := fileLines(targetContent), fileLines(sourceContent)
+	diff := linesDiff(targetLines, sourceLines)
+	if diff == "" && sourceExists && targetExists {
+		return result, nil
+	}
+
+	switch {
+	case !sourceExists:
+		logger.Infof("Target '%s': Removed from the source and needs to be deleted", target.Path)
+	case !targetExists:
+		logger.Infof("Target '%s': Missing and needs to be created. Content:\n%s\n", target.Path, diff)
+	default:
+		logger.Infof("Target '%s': Needs to be updated. Diff:\n%s\n", target.Path, diff)
+	}
+
+	blockResult.Status = StatusOutdated
+	blockResult.Diff = linesUnifiedDiff(targetLines, sourceLines)
+
+	return applyTargetUpdates(ctx, target, write, []*BlockResult{blockResult}, result, dryRun, confirm)
+}
+
+// splitGlob splits the glob into its leading directory without glob characters, and the pattern of the files in it.
+// The pattern is empty if the glob is a plain directory.
+func splitGlob(glob string) (dir, pattern string) {
+	segments := strings.Split(path.Clean(filepath.ToSlash(glob)), "/")
+	for i, segment := range segments {
+		if strings.ContainsAny(segment, config.GlobChars) {
+			return path.Join(segments[:i]...), path.Join(segments[i:]...)
+		}
+	}
+
+	return path.Join(segments...), ""
+}
+
+// listFiles returns the slash-separated paths of the files in dir that match the pattern (or all files if it's
+// empty), relative to dir
+func listFiles(dir, pattern string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to get the relative path of '%s'", filePath)
+		}
+		rel = filepath.ToSlash(rel)
+
+		if pattern != "" {
+			if matched, err := path.Match(pattern, rel); err != nil {
+				return errors.Wrapf(err, "Invalid glob '%s'", pattern)
+			} else if !matched {
+				return nil
+			}
+		}
+
+		files = append(files, rel)
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to walk dir '%s'", dir)
+	}
+
+	return files, nil
+}
+
+func fileLines(content []byte) []string {
+	if len(content) == 0 {
+		return []string{}
+	}
+
+	return strings.Split(string(content), "\n")
+}
@@ -11,7 +11,9 @@ type ClonerMock struct {
 
 func (c *ClonerMock) Clone(
 	ctx context.Context,
-	uri, branch, fixedClonePath string,
+	uri string,
+	ref git.Ref,
+	fixedClonePath string,
 ) (clonePath string, err error) {
 	return "", nil
 }
@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+var (
+	// envVarRegex matches `${VAR}` and `${VAR:-default}`
+	envVarRegex = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)(:-([^}]*))?\}`)
+)
+
+// loadParams loads the params layers of the target, and merges each of them on top of the ones before it
+func loadParams(
+	ctx context.Context,
+	workdir string,
+	target config.Target,
+	cloner git.Cloner,
+) (map[string]interface{}, error) {
+	params := map[string]interface{}{}
+	for _, paramsLayer := range target.Params {
+		values := paramsLayer.Values
+		if !paramsLayer.Inline() {
+			paramsPath, err := ResolveSourcePath(ctx, paramsLayer.Source, workdir, cloner)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to resolve source '%s'", paramsLayer.String())
+			}
+
+			values, err = readParamsFile(paramsPath)
+			if err != nil {
+				return nil, errors.Wrap(err, "Failed to parse params")
+			}
+		}
+
+		interpolated, err := interpolateEnv(values)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to interpolate params '%s'", paramsLayer.String())
+		}
+		values, _ = interpolated.(map[string]interface{})
+
+		params = mergeParams(params, values, paramsLayer.Merge)
+	}
+
+	return params, nil
+}
+
+// readParamsFile reads a params file. The format is determined by the file extension, and defaults to YAML.
+func readParamsFile(path string) (map[string]interface{}, error) {
+	var params map[string]interface{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		b, err := utils.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(b, &params); err != nil {
+			return nil, errors.Wrapf(err, "Failed to unmarshal json file '%s'", path)
+		}
+	case ".toml":
+		b, err := utils.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := toml.Unmarshal(b, &params); err != nil {
+			return nil, errors.Wrapf(err, "Failed to unmarshal toml file '%s'", path)
+		}
+	default:
+		if err := utils.ReadYaml(path, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	return params, nil
+}
+
+// mergeParams merges src on top of dst with the given strategy, and returns the result without modifying either
+func mergeParams(dst, src map[string]interface{}, strategy string) map[string]interface{} {
+	if strategy == config.MergeShallow {
+		return lo.Assign(dst, src)
+	}
+
+	merged := lo.Assign(dst)
+	for key, srcValue := range src {
+		dstValue, ok := merged[key]
+		if !ok {
+			merged[key] = srcValue
+
+			continue
+		}
+
+		switch srcValue := srcValue.(type) {
+		case map[string]interface{}:
+			if dstMap, ok := dstValue.(map[string]interface{}); ok {
+				merged[key] = mergeParams(dstMap, srcValue, strategy)
+
+				continue
+			}
+		case []interface{}:
+			if dstList, ok := dstValue.([]interface{}); ok && strategy == config.MergeAppend {
+				merged[key] = append(append([]interface{}{}, dstList...), srcValue...)
+
+				continue
+			}
+		}
+
+		merged[key] = srcValue
+	}
+
+	return merged
+}
+
+// interpolateEnv replaces `${VAR}` and `${VAR:-default}` in all string values with environment variables.
+// Fails if a variable without a default is not set.
+func interpolateEnv(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		var err error
+		interpolated := envVarRegex.ReplaceAllStringFunc(value, func(match string) string {
+			submatches := envVarRegex.FindStringSubmatch(match)
+			if envValue, ok := os.LookupEnv(submatches[1]); ok {
+				return envValue
+			}
+			if submatches[2] == "" {
+				err = errors.Errorf("Environment variable '%s' is not set", submatches[1])
+			}
+
+			return submatches[3]
+		})
+
+		return interpolated, err
+	case map[string]interface{}:
+		interpolated := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			var err error
+			if interpolated[key], err = interpolateEnv(v); err != nil {
+				return nil, err
+			}
+		}
+
+		return interpolated, nil
+	case []interface{}:
+		interpolated := make([]interface{}, len(value))
+		for i, v := range value {
+			var err error
+			if interpolated[i], err = interpolateEnv(v); err != nil {
+				return nil, err
+			}
+		}
+
+		return interpolated, nil
+	default:
+		return value, nil
+	}
+}
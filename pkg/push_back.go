@@ -0,0 +1,199 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
+	"github.com/ilaif/goplicate/pkg/shared"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+const (
+	pushBackBranch        = "goplicate/push-back-{{ index .BlockNames 0 }}"
+	pushBackCommitMessage = "chore: push back goplicate block '{{ index .BlockNames 0 }}'"
+)
+
+type PushBackOpts struct {
+	DryRun  bool
+	Confirm bool
+	// Force pushes back blocks of templated sources, replacing their template actions with the rendered lines
+	Force bool
+	// BaseBranch the branch of the source repository to open the change request against.
+	// Defaults to the branch of the source, or the default branch of the source repository.
+	BaseBranch string
+	Branch     string
+}
+
+// PushBack writes the lines of a block of a target of the project residing in projectDir back into the matching
+// block of the target's source. If the source is a repository, a change request is opened in it.
+// Returns nil if the source block is already up to date, or if no change request was opened.
+func PushBack(
+	ctx context.Context,
+	projectDir, targetPath, blockName string,
+	cloner git.Cloner,
+	opts *PushBackOpts,
+) (*git.ChangeRequest, error) {
+	logger := log.FromContext(ctx)
+
+	cfg, err := config.LoadProjectConfig(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := findTarget(cfg, targetPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(target.Keys) > 0 {
+		return nil, errors.Errorf("Target '%s' syncs keys, which cannot be pushed back", target.Path)
+	}
+	source := target.Source
+
+	targetBlocks, err := parseBlocksFromFile(filepath.Join(projectDir, target.Path), target.Markers, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse target blocks")
+	}
+	targetBlock := targetBlocks.Get(blockName)
+	if targetBlock == nil {
+		return nil, errors.Errorf("Block '%s' not found in target '%s'", blockName, target.Path)
+	}
+
+	sourceDir, err := resolveSourceDir(ctx, source, projectDir, cloner)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to resolve source '%s'", source.String())
+	}
+	sourcePath := filepath.Join(sourceDir, source.Path)
+
+	// The source is parsed without params, to keep its template actions
+	sourceBlocks, err := parseBlocksFromFile(sourcePath, target.Markers, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse source blocks")
+	}
+	sourceBlock := sourceBlocks.Get(blockName)
+	if sourceBlock == nil {
+		return nil, errors.Errorf("Block '%s' not found in source '%s'", blockName, source.String())
+	}
+
+	if strings.Contains(sourceBlock.Render(), "{{") {
+		if !opts.Force {
+			return nil, errors.Errorf("Block '%s' of source '%s' is templated, and its params cannot be reverted. "+
+				"Use --force to replace the template with the lines of the target", blockName, source.String())
+		}
+
+		logger.Warnf("Block '%s' of source '%s' is templated. Its template actions will be replaced with the "+
+			"lines of the target", blockName, source.String())
+	}
+
+	diff := sourceBlock.Compare(targetBlock)
+	if diff == "" {
+		logger.Infof("Source '%s': Block '%s' is already up to date", source.String(), blockName)
+
+		return nil, nil
+	}
+
+	logger.Infof("Source '%s': Block '%s' needs to be updated. Diff:\n%s\n", source.String(), blockName, diff)
+	unifiedDiff := sourceBlock.UnifiedDiff(targetBlock)
+
+	if opts.DryRun {
+		logger.Infof("Source '%s': In dry-run mode - Not performing any changes", source.String())
+
+		return nil, nil
+	}
+
+	question := "Do you want to apply the above changes to the source?"
+	if answer, err := utils.PromptUserYesNoQuestion(question, opts.Confirm); err != nil {
+		return nil, err
+	} else if !answer {
+		logger.Infof("Source '%s': Skipped", source.String())
+
+		return nil, nil
+	}
+
+	// Syncing pads the lines to the indentation of the source block, reverting the padding of the sync,
+	// and keeps the local regions of the source
+	sourceBlock.Sync(targetBlock)
+	if err := utils.WriteStringToFile(sourcePath, sourceBlocks.Render()); err != nil {
+		return nil, err
+	}
+	logger.Infof("Source '%s': Updated", source.String())
+
+	if source.Repository == "" {
+		return nil, nil
+	}
+
+	return publishPushBack(ctx, projectDir, target, sourceDir, &git.ChangedBlock{Name: blockName, Diff: unifiedDiff}, opts)
+}
+
+// publishPushBack opens a change request in the clone of the source repository with the updated block
+func publishPushBack(
+	ctx context.Context,
+	projectDir string,
+	target *config.Target,
+	sourceDir string,
+	block *git.ChangedBlock,
+	opts *PushBackOpts,
+) (*git.ChangeRequest, error) {
+	logger := log.FromContext(ctx)
+	source := target.Source
+
+	baseBranch := opts.BaseBranch
+	if baseBranch == "" {
+		baseBranch = source.Branch
+	}
+	if baseBranch == "" && source.Ref() != "" {
+		logger.Warnf("Source '%s' is pinned to '%s'. The change request is opened against the default branch",
+			source.String(), source.Ref())
+	}
+
+	changeSet := &git.ChangeSet{Targets: []*git.ChangedTarget{{
+		Path:       filepath.Clean(source.Path),
+		Source:     fmt.Sprintf("%s in %s", target.Path, filepath.Base(projectDir)),
+		SourcePath: filepath.Join(filepath.Base(projectDir), target.Path),
+		Blocks:     []*git.ChangedBlock{block},
+	}}}
+
+	publisher := git.NewPublisher(&shared.State{}, baseBranch, sourceDir, opts.Branch, config.Publish{
+		Branch:        pushBackBranch,
+		CommitMessage: pushBackCommitMessage,
+	})
+	if err := publisher.Init(ctx); err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize git")
+	}
+
+	question := "Do you want to publish the above changes to the source repository?"
+	if answer, err := utils.PromptUserYesNoQuestion(question, opts.Confirm); err != nil {
+		return nil, err
+	} else if !answer {
+		return nil, nil
+	}
+
+	changeRequest, err := publisher.Publish(ctx, changeSet, opts.Confirm)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to publish changes")
+	}
+
+	return changeRequest, nil
+}
+
+// findTarget returns the target (or the sync-config target) of the project config with the given path
+func findTarget(cfg *config.ProjectConfig, path string) (*config.Target, error) {
+	targets := append([]config.Target{}, cfg.Targets...)
+	if cfg.SyncConfig != nil {
+		targets = append(targets, *cfg.SyncConfig)
+	}
+
+	for i := range targets {
+		if filepath.Clean(targets[i].Path) == filepath.Clean(path) {
+			return &targets[i], nil
+		}
+	}
+
+	return nil, errors.Errorf("Target '%s' not found in '%s'", path, config.DefaultProjectConfigFilename)
+}
@@ -0,0 +1,87 @@
+package pkg_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/mocks"
+)
+
+func preparePushBackProject(t *testing.T, source string) (projectDir, sourcePath string) {
+	t.Helper()
+	r := require.New(t)
+
+	projectDir = t.TempDir()
+	sourcePath = filepath.Join(projectDir, "source.yaml")
+	r.NoError(os.WriteFile(sourcePath, []byte(source), 0600))
+	r.NoError(os.WriteFile(filepath.Join(projectDir, ".goplicate.yaml"), []byte(`targets:
+  - path: target.yaml
+    source:
+      path: source.yaml
+`), 0600))
+	r.NoError(os.WriteFile(filepath.Join(projectDir, "target.yaml"), []byte(`root:
+  nested:
+    # goplicate-start(name=settings)
+    key: updated
+
+    other: value
+    # goplicate-end(name=settings)
+`), 0600))
+
+	return projectDir, sourcePath
+}
+
+func TestPushBack(t *testing.T) {
+	r := require.New(t)
+
+	projectDir, sourcePath := preparePushBackProject(t, `# goplicate-start(name=settings)
+key: value
+
+other: value
+# goplicate-end(name=settings)
+`)
+
+	changeRequest, err := pkg.PushBack(context.TODO(), projectDir, "target.yaml", "settings", &mocks.ClonerMock{},
+		&pkg.PushBackOpts{Confirm: true})
+	r.NoError(err)
+	r.Nil(changeRequest)
+
+	content, err := os.ReadFile(sourcePath)
+	r.NoError(err)
+	r.Equal(`# goplicate-start(name=settings)
+key: updated
+
+other: value
+# goplicate-end(name=settings)
+`, string(content))
+}
+
+func TestPushBack_Templated(t *testing.T) {
+	r := require.New(t)
+
+	source := `# goplicate-start(name=settings)
+key: {{ .key }}
+# goplicate-end(name=settings)
+`
+	projectDir, sourcePath := preparePushBackProject(t, source)
+
+	_, err := pkg.PushBack(context.TODO(), projectDir, "target.yaml", "settings", &mocks.ClonerMock{},
+		&pkg.PushBackOpts{Confirm: true})
+	r.ErrorContains(err, "is templated")
+
+	content, err := os.ReadFile(sourcePath)
+	r.NoError(err)
+	r.Equal(source, string(content))
+
+	_, err = pkg.PushBack(context.TODO(), projectDir, "target.yaml", "settings", &mocks.ClonerMock{},
+		&pkg.PushBackOpts{Confirm: true, Force: true})
+	r.NoError(err)
+	content, err = os.ReadFile(sourcePath)
+	r.NoError(err)
+	r.Contains(string(content), "key: updated\n")
+}
@@ -0,0 +1,224 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+const (
+	OutputText  = "text"
+	OutputJSON  = "json"
+	OutputSARIF = "sarif"
+
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+
+	sarifRuleBlockDrift    = "goplicate/block-drift"
+	sarifRuleTargetMissing = "goplicate/target-missing"
+	sarifToolInfoURI       = "https://github.com/ilaif/goplicate"
+	sarifToolName          = "goplicate"
+	sarifResultLevel       = "warning"
+)
+
+var OutputList = []string{OutputText, OutputJSON, OutputSARIF}
+
+// Report a machine-readable report of a goplicate run over one or more projects
+type Report struct {
+	Projects []*ProjectResult `json:"projects"`
+}
+
+func NewReport() *Report {
+	return &Report{Projects: []*ProjectResult{}}
+}
+
+func (r *Report) Add(result *ProjectResult) {
+	if result != nil {
+		r.Projects = append(r.Projects, result)
+	}
+}
+
+// Write writes the report to w in the given output format.
+// File locations are written relative to baseDir.
+func (r *Report) Write(w io.Writer, output string, baseDir string) error {
+	var doc interface{}
+	switch output {
+	case OutputText:
+		return nil
+	case OutputJSON:
+		doc = r
+	case OutputSARIF:
+		doc = r.toSARIF(baseDir)
+	default:
+		return errors.Errorf("Unknown output format '%s'. Must be one of %s", output, OutputList)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return errors.Wrap(err, "Failed to encode report")
+	}
+
+	return nil
+}
+
+// Failed returns the number of projects that failed
+func (r *Report) Failed() int {
+	return lo.CountBy(r.Projects, func(p *ProjectResult) bool { return p.Status == StatusError })
+}
+
+// WriteSummary writes a human-readable summary table of the projects in the report
+func (r *Report) WriteSummary(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROJECT\tSTATUS\tPULL REQUEST\tERROR")
+
+	counts := map[Status]int{}
+	for _, project := range r.Projects {
+		counts[project.Status]++
+		errLine := strings.SplitN(project.Error, "\n", 2)[0]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", project.Path, project.Status, project.PullRequestURL, errLine)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return errors.Wrap(err, "Failed to write summary")
+	}
+
+	fmt.Fprintf(w, "\n%d updated, %d outdated, %d unchanged, %d failed, %d published\n", counts[StatusUpdated],
+		counts[StatusOutdated], counts[StatusUpToDate], counts[StatusError], counts[StatusPublished])
+
+	return nil
+}
+
+func (r *Report) toSARIF(baseDir string) *sarifLog {
+	results := []sarifResult{}
+	for _, project := range r.Projects {
+		for _, target := range project.Targets {
+			uri := filepath.ToSlash(relPath(baseDir, filepath.Join(project.Path, target.Path)))
+
+			if target.Status == StatusMissing {
+				results = append(results, sarifResult{
+					RuleID:    sarifRuleTargetMissing,
+					Level:     sarifResultLevel,
+					Message:   sarifMessage{Text: fmt.Sprintf("Target is missing and should be synced from '%s'", target.Source)},
+					Locations: []sarifLocation{newSARIFLocation(uri, 1)},
+				})
+			}
+
+			for _, block := range target.Blocks {
+				if block.Diff == "" {
+					continue
+				}
+
+				results = append(results, sarifResult{
+					RuleID: sarifRuleBlockDrift,
+					Level:  sarifResultLevel,
+					Message: sarifMessage{Text: fmt.Sprintf("Block '%s' is out of date with '%s':\n%s",
+						block.Name, target.Source, block.Diff)},
+					Locations: []sarifLocation{newSARIFLocation(uri, block.StartLine)},
+				})
+			}
+		}
+	}
+
+	return &sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           sarifToolName,
+				InformationURI: sarifToolInfoURI,
+				Rules: []sarifRule{
+					{
+						ID:               sarifRuleBlockDrift,
+						ShortDescription: sarifMessage{Text: "A goplicate block is out of date with its source"},
+					},
+					{
+						ID:               sarifRuleTargetMissing,
+						ShortDescription: sarifMessage{Text: "A goplicate target file is missing"},
+					},
+				},
+			}},
+			Results: results,
+		}},
+	}
+}
+
+func relPath(baseDir, path string) string {
+	if baseDir == "" {
+		return path
+	}
+
+	rel, err := filepath.Rel(baseDir, path)
+	if err != nil {
+		return path
+	}
+
+	return rel
+}
+
+func newSARIFLocation(uri string, startLine int) sarifLocation {
+	return sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: uri},
+		Region:           sarifRegion{StartLine: lo.Max([]int{startLine, 1})},
+	}}
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
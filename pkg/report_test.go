@@ -0,0 +1,83 @@
+package pkg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg"
+)
+
+func newTestReport() *pkg.Report {
+	report := pkg.NewReport()
+	report.Add(&pkg.ProjectResult{
+		Path: "/projects/repo-1",
+		Targets: []*pkg.TargetResult{
+			{
+				Path:   ".eslintrc.js",
+				Source: "../shared/.eslintrc.js",
+				Status: pkg.StatusOutdated,
+				Blocks: []*pkg.BlockResult{
+					{Name: "common-rules", Status: pkg.StatusOutdated, StartLine: 4, Diff: "-a\n+b\n"},
+					{Name: "other", Status: pkg.StatusUpToDate, StartLine: 12},
+				},
+			},
+		},
+	})
+
+	return report
+}
+
+func TestReport_JSON(t *testing.T) {
+	r := require.New(t)
+
+	var buf bytes.Buffer
+	r.NoError(newTestReport().Write(&buf, pkg.OutputJSON, ""))
+
+	report := &pkg.Report{}
+	r.NoError(json.Unmarshal(buf.Bytes(), report))
+	r.Equal(newTestReport(), report)
+}
+
+func TestReport_SARIF(t *testing.T) {
+	r := require.New(t)
+
+	var buf bytes.Buffer
+	r.NoError(newTestReport().Write(&buf, pkg.OutputSARIF, "/projects"))
+
+	var sarif struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	r.NoError(json.Unmarshal(buf.Bytes(), &sarif))
+
+	r.Equal("2.1.0", sarif.Version)
+	r.Len(sarif.Runs, 1)
+	r.Len(sarif.Runs[0].Results, 1)
+	result := sarif.Runs[0].Results[0]
+	r.Equal("goplicate/block-drift", result.RuleID)
+	r.Equal("repo-1/.eslintrc.js", result.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	r.Equal(4, result.Locations[0].PhysicalLocation.Region.StartLine)
+}
+
+func TestReport_UnknownOutput(t *testing.T) {
+	r := require.New(t)
+
+	r.Error(newTestReport().Write(&bytes.Buffer{}, "xml", ""))
+}
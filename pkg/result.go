@@ -0,0 +1,106 @@
+package pkg
+
+// Status the outcome of syncing a target or a block
+type Status string
+
+const (
+	StatusUpToDate        Status = "up-to-date"
+	StatusOutdated        Status = "outdated"
+	StatusUpdated         Status = "updated"
+	StatusSkipped         Status = "skipped"
+	StatusMissing         Status = "missing"
+	StatusMissingInSource Status = "missing-in-source"
+	StatusExcluded        Status = "excluded"
+	StatusError           Status = "error"
+	StatusPublished       Status = "published"
+)
+
+// ProjectResult the outcome of running goplicate on a single project
+type ProjectResult struct {
+	Path           string          `json:"path"`
+	Status         Status          `json:"status"`
+	Targets        []*TargetResult `json:"targets"`
+	Hooks          []*HookResult   `json:"hooks,omitempty"`
+	PullRequestURL string          `json:"pullRequestUrl,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+// NewFailedProjectResult creates a result for a project that failed before it could be run
+func NewFailedProjectResult(path string, err error) *ProjectResult {
+	return &ProjectResult{Path: path, Status: StatusError, Targets: []*TargetResult{}, Error: err.Error()}
+}
+
+func (r *ProjectResult) computeStatus() Status {
+	if r.Error != "" {
+		return StatusError
+	}
+
+	if r.PullRequestURL != "" {
+		return StatusPublished
+	}
+
+	for _, target := range r.Targets {
+		if target.Updated() {
+			return StatusUpdated
+		}
+	}
+
+	// The targets have changes that weren't written (e.g. in dry-run mode)
+	for _, target := range r.Targets {
+		if target.Status == StatusOutdated || target.Drifted() {
+			return StatusOutdated
+		}
+	}
+
+	return StatusUpToDate
+}
+
+// TargetResult the outcome of running a single target
+type TargetResult struct {
+	Path   string `json:"path"`
+	Source string `json:"source"`
+	// SourceCommit the commit SHA of the source repository, if the source is a repository
+	SourceCommit string `json:"sourceCommit,omitempty"`
+	Status       Status `json:"status"`
+	// Blocks the results of all the named blocks in the target
+	Blocks []*BlockResult `json:"blocks,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// Drifted whether the target is out of date compared to its source
+func (r *TargetResult) Drifted() bool {
+	if r.Status == StatusMissing {
+		return true
+	}
+
+	for _, block := range r.Blocks {
+		if block.Diff != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Updated whether the changes were applied to the target file
+func (r *TargetResult) Updated() bool {
+	return r.Status == StatusUpdated
+}
+
+// BlockResult the outcome of comparing a single target block with its source
+type BlockResult struct {
+	Name      string `json:"name"`
+	Status    Status `json:"status"`
+	StartLine int    `json:"startLine"`
+	// Diff a unified diff between the target block and the source block
+	Diff string `json:"diff,omitempty"`
+	// Conflict whether merging the upstream changes into the local edits of the block resulted in conflicts
+	Conflict bool `json:"conflict,omitempty"`
+}
+
+// HookResult the outcome of running a single post hook
+type HookResult struct {
+	Command string `json:"command"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
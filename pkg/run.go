@@ -2,9 +2,13 @@ package pkg
 
 import (
 	"context"
+	"os"
+	"path"
+	"path/filepath"
 
 	"github.com/caarlos0/log"
 	"github.com/pkg/errors"
+	"github.com/samber/lo"
 
 	"github.com/ilaif/goplicate/pkg/config"
 	"github.com/ilaif/goplicate/pkg/git"
@@ -13,104 +17,205 @@ import (
 )
 
 type RunOpts struct {
-	DryRun       bool
-	Confirm      bool
-	Publish      bool
-	AllowDirty   bool
-	Force        bool
-	StashChanges bool
-	BaseBranch   string
-	Branch       string
+	DryRun        bool
+	Confirm       bool
+	Publish       bool
+	AllowDirty    bool
+	Force         bool
+	StashChanges  bool
+	UpdateInPlace bool
+	// Locked whether to sync the source repositories at the commits recorded in the lock file
+	Locked     bool
+	BaseBranch string
+	Branch     string
+	// PublishDefaults the publish settings to use for settings that the project config does not set
+	PublishDefaults config.Publish
+	// Interactive whether to approve the update of every block (or some of its hunks) instead of every target
+	Interactive bool
+	// OnlyTargets the paths (or globs) of the only targets to sync, if given
+	OnlyTargets []string
+	// OnlyBlocks the names of the only blocks (or key paths) to sync, if given
+	OnlyBlocks []string
 }
 
 func NewRunOpts(
-	dryRun, confirm, publish, allowDirty, force, stashChanges bool,
+	dryRun, confirm, publish, allowDirty, force, stashChanges, updateInPlace, locked bool,
 	baseBranch, branch string,
 ) *RunOpts {
 	return &RunOpts{
-		DryRun:       dryRun,
-		Confirm:      confirm,
-		Publish:      publish,
-		AllowDirty:   allowDirty,
-		Force:        force,
-		StashChanges: stashChanges,
-		BaseBranch:   baseBranch,
-		Branch:       branch,
+		DryRun:        dryRun,
+		Confirm:       confirm,
+		Publish:       publish,
+		AllowDirty:    allowDirty,
+		Force:         force,
+		StashChanges:  stashChanges,
+		UpdateInPlace: updateInPlace,
+		Locked:        locked,
+		BaseBranch:    baseBranch,
+		Branch:        branch,
 	}
 }
 
+// Run syncs the project residing in projectDir.
+// The returned result is never nil, and describes the project state even if an error occurred.
 func Run(
 	ctx context.Context,
+	projectDir string,
 	cloner git.Cloner,
 	sharedState *shared.State,
 	runOpts *RunOpts,
-) error {
-	cfg, err := config.LoadProjectConfig()
+) (result *ProjectResult, err error) {
+	logger := log.FromContext(ctx)
+	result = &ProjectResult{Path: projectDir}
+	defer func() {
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Status = result.computeStatus()
+	}()
+
+	cfg, err := config.LoadProjectConfig(projectDir)
 	if err != nil {
+		return result, err
+	}
+
+	lockFile, err := config.LoadLockFile(projectDir)
+	if err != nil {
+		return result, err
+	}
+	lockingCloner := newLockingCloner(cloner, lockFile, runOpts.Locked)
+
+	changeSet := &git.ChangeSet{}
+
+	failTarget := func(target config.Target, err error) error {
+		err = errors.Wrapf(err, "Target '%s'", target.Path)
+		result.Targets = append(result.Targets, &TargetResult{
+			Path:   target.Path,
+			Source: target.Source.String(),
+			Status: StatusError,
+			Error:  err.Error(),
+		})
+
 		return err
 	}
 
-	updatedTargetPaths := []string{}
+	runTarget := func(target config.Target) error {
+		fileTargets, err := ExpandTarget(ctx, projectDir, target, lockingCloner)
+		if err != nil {
+			return failTarget(target, err)
+		}
 
-	if cfg.SyncConfig != nil {
-		target := *cfg.SyncConfig
+		selected := runOpts.selectsTarget(target.Path)
+		for _, fileTarget := range fileTargets {
+			if !selected && !runOpts.selectsTarget(fileTarget.Path) {
+				logger.Debugf("Target '%s': Not selected. Skipping", fileTarget.Path)
 
-		if updated, err := RunTarget(ctx, target, cloner, runOpts.DryRun, runOpts.Confirm); err != nil {
-			return errors.Wrapf(err, "Target '%s'", target.Path)
-		} else if updated {
-			updatedTargetPaths = append(updatedTargetPaths, target.Path)
+				continue
+			}
+
+			var ok bool
+			if fileTarget, ok = runOpts.withOnlyBlocks(fileTarget); !ok {
+				logger.Debugf("Target '%s': None of the selected blocks are synced. Skipping", fileTarget.Path)
+
+				continue
+			}
+
+			targetResult, err := RunTarget(ctx, projectDir, fileTarget, lockingCloner,
+				runOpts.DryRun, runOpts.Confirm, runOpts.Interactive)
+			if err != nil {
+				return failTarget(fileTarget, err)
+			}
+
+			result.Targets = append(result.Targets, targetResult)
+			if targetResult.Updated() {
+				changeSet.Targets = append(changeSet.Targets, newChangedTarget(fileTarget, targetResult))
+			}
+		}
+
+		return nil
+	}
+
+	if cfg.SyncConfig != nil {
+		if err := runTarget(*cfg.SyncConfig); err != nil {
+			return result, err
 		}
 
 		// Reload the config
-		cfg, err = config.LoadProjectConfig()
+		cfg, err = config.LoadProjectConfig(projectDir)
 		if err != nil {
-			return err
+			return result, err
 		}
 	}
 
-	publisher := git.NewPublisher(sharedState, runOpts.BaseBranch, utils.MustGetwd(), runOpts.Branch)
+	publishCfg := cfg.Publish.WithDefaults(runOpts.PublishDefaults)
+	publishCfg.UpdateInPlace = publishCfg.UpdateInPlace || runOpts.UpdateInPlace
+	publisher := git.NewPublisher(sharedState, runOpts.BaseBranch, projectDir, runOpts.Branch, publishCfg)
 
 	if !runOpts.DryRun && runOpts.Publish {
 		if err := publisher.Init(ctx); err != nil {
-			return errors.Wrap(err, "Failed to initialize git")
+			return result, errors.Wrap(err, "Failed to initialize git")
 		}
 
 		if !publisher.IsClean() {
 			if runOpts.StashChanges {
 				restoreStashedChanges, err := publisher.StashChanges(ctx)
 				if err != nil {
-					return errors.Wrap(err, "Failed to stash changes")
+					return result, errors.Wrap(err, "Failed to stash changes")
 				}
 
 				defer func() {
 					if err := restoreStashedChanges(); err != nil {
-						log.IncreasePadding()
-						log.WithError(err).Warn("Cleanup: Failed to restore stashed changes")
-						log.DecreasePadding()
+						logger.IncreasePadding()
+						logger.WithError(err).Warn("Cleanup: Failed to restore stashed changes")
+						logger.DecreasePadding()
 					}
 				}()
 			} else if !runOpts.AllowDirty {
-				return errors.New("Git worktree is not clean. Please commit or stash changes before running again")
+				return result, errors.New("Git worktree is not clean. Please commit or stash changes before running again")
 			}
 		}
 	}
 
 	for _, target := range cfg.Targets {
-		if updated, err := RunTarget(ctx, target, cloner, runOpts.DryRun, runOpts.Confirm); err != nil {
-			return errors.Wrapf(err, "Target '%s'", target.Path)
-		} else if updated {
-			updatedTargetPaths = append(updatedTargetPaths, target.Path)
+		if err := runTarget(target); err != nil {
+			return result, err
 		}
 	}
 
-	if !runOpts.Force && len(updatedTargetPaths) == 0 {
-		return nil
+	resolved := lockingCloner.resolved
+	if len(runOpts.OnlyTargets) > 0 || len(runOpts.OnlyBlocks) > 0 {
+		// The sources of the targets that were not selected were not cloned, so they keep their locked commits
+		resolved = lockFile.Merge(resolved)
+	}
+
+	if !runOpts.DryRun && !resolved.Equal(lockFile) {
+		logger.Debugf("Updating the lock file '%s'", config.LockFilename)
+		if err := resolved.Save(projectDir); err != nil {
+			return result, err
+		}
+		changeSet.Files = append(changeSet.Files, config.LockFilename)
+	}
+
+	if runOpts.Interactive || lo.SomeBy(cfg.Targets, func(target config.Target) bool { return target.ThreeWayMerge }) {
+		if _, err := os.Stat(filepath.Join(projectDir, config.StateFilename)); err == nil {
+			changeSet.Files = append(changeSet.Files, config.StateFilename)
+		}
+	}
+
+	if !runOpts.Force && len(changeSet.Targets) == 0 {
+		return result, nil
 	}
 
 	if !runOpts.DryRun {
 		for _, hook := range cfg.Hooks.Post {
-			if err := RunHook(ctx, hook); err != nil {
-				return err
+			output, err := RunHook(ctx, projectDir, hook)
+			hookResult := &HookResult{Command: hook, Output: output}
+			result.Hooks = append(result.Hooks, hookResult)
+			changeSet.Hooks = append(changeSet.Hooks, &git.HookOutput{Command: hook, Output: output})
+			if err != nil {
+				hookResult.Error = err.Error()
+
+				return result, err
 			}
 		}
 	}
@@ -118,13 +223,59 @@ func Run(
 	if !runOpts.DryRun && runOpts.Publish {
 		question := "Do you want to publish the above changes?"
 		if answer, err := utils.PromptUserYesNoQuestion(question, runOpts.Confirm); err != nil {
-			return err
+			return result, err
 		} else if answer {
-			if err := publisher.Publish(ctx, updatedTargetPaths, runOpts.Confirm); err != nil {
-				return errors.Wrap(err, "Failed to publish changes")
+			changeRequest, err := publisher.Publish(ctx, changeSet, runOpts.Confirm)
+			if err != nil {
+				return result, errors.Wrap(err, "Failed to publish changes")
 			}
+			result.PullRequestURL = changeRequest.URL
+		}
+	}
+
+	return result, nil
+}
+
+// selectsTarget whether the target path matches one of the only-target filters, if given
+func (o *RunOpts) selectsTarget(targetPath string) bool {
+	if len(o.OnlyTargets) == 0 {
+		return true
+	}
+
+	return lo.SomeBy(o.OnlyTargets, func(pattern string) bool {
+		matched, err := path.Match(pattern, targetPath)
+
+		return pattern == targetPath || (err == nil && matched)
+	})
+}
+
+// withOnlyBlocks returns the target with its included blocks limited to the only-block filters, if given.
+// Returns false if the target doesn't sync any of them.
+func (o *RunOpts) withOnlyBlocks(target config.Target) (config.Target, bool) {
+	if len(o.OnlyBlocks) == 0 {
+		return target, true
+	}
+
+	target.IncludeBlocks = lo.Filter(o.OnlyBlocks, func(name string, _ int) bool { return target.SyncsBlock(name) })
+
+	return target, len(target.IncludeBlocks) > 0
+}
+
+// newChangedTarget describes the updates of an updated target for publishing
+func newChangedTarget(target config.Target, targetResult *TargetResult) *git.ChangedTarget {
+	changedTarget := &git.ChangedTarget{
+		Path:             target.Path,
+		Source:           target.Source.String(),
+		SourceRepository: string(target.Source.Repository),
+		SourceRef:        target.Source.Ref(),
+		SourceCommit:     targetResult.SourceCommit,
+		SourcePath:       target.Source.Path,
+	}
+	for _, block := range targetResult.Blocks {
+		if block.Status == StatusUpdated {
+			changedTarget.Blocks = append(changedTarget.Blocks, &git.ChangedBlock{Name: block.Name, Diff: block.Diff})
 		}
 	}
 
-	return nil
+	return changedTarget
 }
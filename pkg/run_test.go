@@ -1,15 +1,21 @@
 package pkg_test
 
 import (
+	"bytes"
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/ilaif/goplicate/pkg"
 	"github.com/ilaif/goplicate/pkg/cmd/testutils"
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
 	"github.com/ilaif/goplicate/pkg/mocks"
 	"github.com/ilaif/goplicate/pkg/shared"
+	"github.com/ilaif/goplicate/pkg/utils"
 )
 
 func TestRun_Success_SyncConfig(t *testing.T) {
@@ -18,14 +24,308 @@ func TestRun_Success_SyncConfig(t *testing.T) {
 	defer testutils.PrepareWorkdir(t, "../examples/sync-config", ".")()
 
 	cloner := &mocks.ClonerMock{}
-	opts := pkg.NewRunOpts(false, true, false, false, false, false, "", "")
+	opts := pkg.NewRunOpts(false, true, false, false, false, false, false, false, "", "")
 
 	sharedState := &shared.State{
 		Message: "",
 	}
 
-	r.NoError(pkg.Run(context.TODO(), cloner, sharedState, opts))
+	result, err := pkg.Run(context.TODO(), utils.MustGetwd(), cloner, sharedState, opts)
+	r.NoError(err)
+	r.Len(result.Targets, 3)
+	r.Equal(pkg.StatusUpdated, result.Targets[0].Status)
 
 	testutils.RequireFileContains(r, ".goplicate.yaml", "path: new.yaml")
 	testutils.RequireFileContains(r, "new.yaml", "newKey: newValue")
 }
+
+func TestRun_DryRunReportsOutdated(t *testing.T) {
+	r := require.New(t)
+
+	defer testutils.PrepareWorkdir(t, "../examples/sync-config", ".")()
+
+	opts := pkg.NewRunOpts(true, true, false, false, false, false, false, false, "", "")
+	result, err := pkg.Run(context.TODO(), utils.MustGetwd(), &mocks.ClonerMock{}, &shared.State{}, opts)
+	r.NoError(err)
+	r.Equal(pkg.StatusOutdated, result.Status)
+
+	var buf bytes.Buffer
+	report := pkg.NewReport()
+	report.Add(result)
+	r.NoError(report.WriteSummary(&buf))
+	r.Contains(buf.String(), "0 updated, 1 outdated, 0 unchanged, 0 failed, 0 published")
+}
+
+func TestRun_SameRepositoryDifferentRefs(t *testing.T) {
+	r := require.New(t)
+
+	block := func(value string) string {
+		return "# goplicate-start(name=settings)\nvalue: " + value + "\n# goplicate-end(name=settings)\n"
+	}
+
+	sourceRepoDir := testutils.CreateGitRepository(t, map[string]string{"settings.yaml": block("1")})
+	testutils.RunGit(t, sourceRepoDir, "tag", "v1")
+	testutils.CommitGitFiles(t, sourceRepoDir, map[string]string{"settings.yaml": block("2")})
+
+	projectDir := t.TempDir()
+	r.NoError(os.WriteFile(filepath.Join(projectDir, ".goplicate.yaml"), []byte(`targets:
+  - path: pinned.yaml
+    source:
+      repository: file://`+sourceRepoDir+`
+      tag: v1
+      path: settings.yaml
+  - path: latest.yaml
+    source:
+      repository: file://`+sourceRepoDir+`
+      path: settings.yaml
+`), 0600))
+	r.NoError(os.WriteFile(filepath.Join(projectDir, "pinned.yaml"), []byte(block("0")), 0600))
+	r.NoError(os.WriteFile(filepath.Join(projectDir, "latest.yaml"), []byte(block("0")), 0600))
+
+	cloner := git.NewCloner()
+	defer cloner.Close()
+	opts := pkg.NewRunOpts(false, true, false, false, false, false, false, false, "", "")
+
+	_, err := pkg.Run(context.TODO(), projectDir, cloner, &shared.State{}, opts)
+	r.NoError(err)
+
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "pinned.yaml"), "value: 1")
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "latest.yaml"), "value: 2")
+}
+
+func TestRun_MirrorTargets(t *testing.T) {
+	r := require.New(t)
+
+	block := func(value string) string {
+		return "# goplicate-start:steps\nsteps: " + value + "\n# goplicate-end:steps\n"
+	}
+
+	projectDir := t.TempDir()
+	files := map[string]string{
+		".goplicate.yaml": `targets:
+  - path: .github/workflows/*.yml
+    source:
+      path: shared/workflows
+    mirror:
+      create: true
+      delete: true
+  - path: docs
+    source:
+      path: shared/docs
+    mirror:
+      sync: true
+`,
+		"shared/workflows/ci.yml":       "name: ci\n" + block("shared"),
+		"shared/workflows/release.yml":  "name: release\n",
+		"shared/workflows/nested/x.yml": "nested\n",
+		"shared/docs/README.md":         "shared docs\n",
+		"shared/docs/guides/setup.md":   "setup\n",
+		".github/workflows/ci.yml":      "name: my-ci\n" + block("local"),
+		".github/workflows/old.yml":     "old\n",
+		".github/workflows/local.yaml":  "not matched\n",
+		"docs/README.md":                "local docs\n",
+		"docs/local.md":                 "local\n",
+	}
+	for name, content := range files {
+		r.NoError(os.MkdirAll(filepath.Dir(filepath.Join(projectDir, name)), 0750))
+		r.NoError(os.WriteFile(filepath.Join(projectDir, name), []byte(content), 0600))
+	}
+
+	opts := pkg.NewRunOpts(false, true, false, false, false, false, false, false, "", "")
+	result, err := pkg.Run(context.TODO(), projectDir, &mocks.ClonerMock{}, &shared.State{}, opts)
+	r.NoError(err)
+	r.Len(result.Targets, 4)
+
+	readFile := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(projectDir, name))
+		r.NoError(err)
+
+		return string(content)
+	}
+
+	r.Equal("name: my-ci\n"+block("shared"), readFile(".github/workflows/ci.yml"))
+	r.Equal("name: release\n", readFile(".github/workflows/release.yml"))
+	r.NoFileExists(filepath.Join(projectDir, ".github/workflows/old.yml"))
+	r.NoFileExists(filepath.Join(projectDir, ".github/workflows/nested/x.yml"))
+	r.Equal("not matched\n", readFile(".github/workflows/local.yaml"))
+	r.Equal("shared docs\n", readFile("docs/README.md"))
+	r.Equal("local\n", readFile("docs/local.md"))
+	r.NoFileExists(filepath.Join(projectDir, "docs/guides/setup.md"))
+}
+
+func TestRun_MirrorRemovedSourceDirectory(t *testing.T) {
+	r := require.New(t)
+
+	sourceRepoDir := testutils.CreateGitRepository(t, map[string]string{
+		"docs/README.md": "shared docs\n",
+		"other.txt":      "other\n",
+	})
+
+	projectDir := t.TempDir()
+	r.NoError(os.WriteFile(filepath.Join(projectDir, ".goplicate.yaml"), []byte(`targets:
+  - path: docs
+    source:
+      repository: file://`+sourceRepoDir+`
+      path: docs
+    mirror:
+      create: true
+      delete: true
+`), 0600))
+
+	run := func() {
+		cloner := git.NewCloner()
+		defer cloner.Close()
+		opts := pkg.NewRunOpts(false, true, false, false, false, false, false, false, "", "")
+		_, err := pkg.Run(context.TODO(), projectDir, cloner, &shared.State{}, opts)
+		r.NoError(err)
+	}
+
+	run()
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "docs/README.md"), "shared docs")
+
+	// The mirrored files are deleted once their source directory is removed upstream
+	testutils.RunGit(t, sourceRepoDir, "rm", "-r", "--quiet", "docs")
+	testutils.RunGit(t, sourceRepoDir, "commit", "--quiet", "-m", "remove docs")
+	run()
+	r.NoFileExists(filepath.Join(projectDir, "docs/README.md"))
+}
+
+func TestRun_BlockFilters(t *testing.T) {
+	r := require.New(t)
+
+	block := func(name, value string) string {
+		return "# goplicate-start:" + name + "\n" + value + "\n# goplicate-end:" + name + "\n"
+	}
+	frozenBlock := func(name, value string) string {
+		return "# goplicate-start(name=" + name + ",frozen=true)\n" + value + "\n# goplicate-end:" + name + "\n"
+	}
+
+	projectDir := t.TempDir()
+	files := map[string]string{
+		".goplicate.yaml": `targets:
+  - path: a.yaml
+    source:
+      path: source.yaml
+    exclude-blocks: [excluded]
+  - path: b.yaml
+    source:
+      path: source.yaml
+`,
+		"source.yaml": block("synced", "new") + block("excluded", "new") + block("frozen", "new") +
+			block("other", "new"),
+		"a.yaml": block("synced", "old") + block("excluded", "old") + frozenBlock("frozen", "old") +
+			block("other", "old"),
+		"b.yaml": block("synced", "old"),
+	}
+	for name, content := range files {
+		r.NoError(os.WriteFile(filepath.Join(projectDir, name), []byte(content), 0600))
+	}
+
+	opts := pkg.NewRunOpts(false, true, false, false, false, false, false, false, "", "")
+	opts.OnlyTargets = []string{"a.*"}
+	opts.OnlyBlocks = []string{"synced", "excluded", "frozen"}
+	result, err := pkg.Run(context.TODO(), projectDir, &mocks.ClonerMock{}, &shared.State{}, opts)
+	r.NoError(err)
+	r.Len(result.Targets, 1)
+
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "a.yaml"),
+		block("synced", "new")+block("excluded", "old")+frozenBlock("frozen", "old")+block("other", "old"))
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "b.yaml"), block("synced", "old"))
+}
+
+func TestRun_FilteredRunKeepsLockedRepositories(t *testing.T) {
+	r := require.New(t)
+
+	t.Setenv(git.CacheDirEnv, t.TempDir())
+	block := func(value string) string {
+		return "# goplicate-start:settings\nvalue: " + value + "\n# goplicate-end:settings\n"
+	}
+	repoA := testutils.CreateGitRepository(t, map[string]string{"settings.yaml": block("a")})
+	repoB := testutils.CreateGitRepository(t, map[string]string{"settings.yaml": block("b")})
+
+	projectDir := t.TempDir()
+	files := map[string]string{
+		".goplicate.yaml": `targets:
+  - path: a.yaml
+    source:
+      repository: file://` + repoA + `
+      path: settings.yaml
+  - path: b.yaml
+    source:
+      repository: file://` + repoB + `
+      path: settings.yaml
+`,
+		"a.yaml": block("0"),
+		"b.yaml": block("0"),
+	}
+	for name, content := range files {
+		r.NoError(os.WriteFile(filepath.Join(projectDir, name), []byte(content), 0600))
+	}
+
+	cloner := git.NewCloner()
+	defer cloner.Close()
+	_, err := pkg.Update(context.TODO(), projectDir, cloner)
+	r.NoError(err)
+
+	opts := pkg.NewRunOpts(false, true, false, false, false, false, false, false, "", "")
+	opts.OnlyTargets = []string{"a.yaml"}
+	_, err = pkg.Run(context.TODO(), projectDir, cloner, &shared.State{}, opts)
+	r.NoError(err)
+
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "a.yaml"), "value: a")
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "b.yaml"), "value: 0")
+	lockFile, err := config.LoadLockFile(projectDir)
+	r.NoError(err)
+	r.NotEmpty(lockFile.Get("file://"+repoA, ""))
+	r.NotEmpty(lockFile.Get("file://"+repoB, ""))
+}
+
+func TestUpdate_KeepsUnchangedLockFile(t *testing.T) {
+	r := require.New(t)
+
+	t.Setenv(git.CacheDirEnv, t.TempDir())
+	block := "# goplicate-start:settings\nvalue: 1\n# goplicate-end:settings\n"
+	repo := testutils.CreateGitRepository(t, map[string]string{"settings.yaml": block})
+
+	projectDir := t.TempDir()
+	files := map[string]string{
+		".goplicate.yaml": `targets:
+  - path: settings.yaml
+    source:
+      repository: file://` + repo + `
+      path: settings.yaml
+`,
+		"settings.yaml": block,
+	}
+	for name, content := range files {
+		r.NoError(os.WriteFile(filepath.Join(projectDir, name), []byte(content), 0600))
+	}
+
+	cloner := git.NewCloner()
+	defer cloner.Close()
+	_, err := pkg.Update(context.TODO(), projectDir, cloner)
+	r.NoError(err)
+
+	lockPath := filepath.Join(projectDir, config.LockFilename)
+	content, err := os.ReadFile(lockPath)
+	r.NoError(err)
+	content = append(content, "# edited\n"...)
+	r.NoError(os.WriteFile(lockPath, content, 0600))
+
+	// The lock file is only written when the resolved commits change
+	_, err = pkg.Update(context.TODO(), projectDir, cloner)
+	r.NoError(err)
+	opts := pkg.NewRunOpts(false, true, false, false, false, false, false, false, "", "")
+	_, err = pkg.Run(context.TODO(), projectDir, cloner, &shared.State{}, opts)
+	r.NoError(err)
+	testutils.RequireFileContains(r, lockPath, "# edited\n")
+
+	testutils.CommitGitFiles(t, repo, map[string]string{"settings.yaml": block + "\n"})
+	updateCloner := git.NewCloner()
+	defer updateCloner.Close()
+	_, err = pkg.Update(context.TODO(), projectDir, updateCloner)
+	r.NoError(err)
+	content, err = os.ReadFile(lockPath)
+	r.NoError(err)
+	r.NotContains(string(content), "# edited")
+}
@@ -3,5 +3,5 @@ package shared
 // State a shared state struct to pass state during goplicate sync
 // between different project runs.
 type State struct {
-	Message string // Message the message for the change request
+	Message string // Message the message for the change request, if given explicitly (e.g. with --message)
 }
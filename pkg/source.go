@@ -14,13 +14,24 @@ import (
 // ResolveSourcePath given a source, resolves it by cloning the repository (if applicable)
 // and returning the directory of the source.
 func ResolveSourcePath(ctx context.Context, source config.Source, workdir string, cloner git.Cloner) (string, error) {
-	log.Debugf("Resolving path of source '%s'", source.String())
+	log.FromContext(ctx).Debugf("Resolving path of source '%s'", source.String())
 
+	dir, err := resolveSourceDir(ctx, source, workdir, cloner)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(dir, source.Path), nil
+}
+
+// resolveSourceDir returns the directory that the path of the source is relative to:
+// the clone of the source repository, or workdir if the source is a local path
+func resolveSourceDir(ctx context.Context, source config.Source, workdir string, cloner git.Cloner) (string, error) {
 	var err error
 
-	branch := source.Branch
+	ref := git.Ref{Branch: source.Branch, Commit: source.Commit}
 	if source.Tag != "" {
-		branch = source.Tag
+		ref.Branch = source.Tag
 	}
 
 	dir := workdir
@@ -29,11 +40,11 @@ func ResolveSourcePath(ctx context.Context, source config.Source, workdir string
 		if source.ClonePath != "" {
 			absClonePath = path.Join(workdir, source.ClonePath)
 		}
-		dir, err = cloner.Clone(ctx, string(source.Repository), branch, absClonePath)
+		dir, err = cloner.Clone(ctx, string(source.Repository), ref, absClonePath)
 		if err != nil {
 			return "", errors.Wrap(err, "Failed to clone repository")
 		}
 	}
 
-	return path.Join(dir, source.Path), nil
+	return dir, nil
 }
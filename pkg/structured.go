@@ -0,0 +1,367 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+type structuredFormat string
+
+const (
+	formatYAML structuredFormat = "yaml"
+	formatJSON structuredFormat = "json"
+	formatTOML structuredFormat = "toml"
+
+	defaultIndent = 2
+)
+
+// runStructuredTarget syncs the key paths of a YAML, JSON or TOML target from its source document.
+// The target keeps its comments and key order, except for TOML files which are rewritten.
+// If interactive is set, the user approves the update of every key path instead of the update of the whole target.
+func runStructuredTarget(
+	ctx context.Context,
+	target config.Target,
+	targetPath, sourcePath string,
+	params map[string]interface{},
+	result *TargetResult,
+	dryRun, confirm, interactive bool,
+) (*TargetResult, error) {
+	logger := log.FromContext(ctx)
+
+	targetContent, err := utils.ReadFile(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	targetDoc, err := parseStructured(structuredFormatOf(targetPath), targetContent)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse target '%s'", target.Path)
+	}
+
+	sourceContent, err := utils.ReadFile(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	renderedSource, err := renderTemplate(filepath.Base(sourcePath), string(sourceContent), params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to render source '%s'", sourcePath)
+	}
+	sourceDoc, err := parseStructured(structuredFormatOf(sourcePath), []byte(renderedSource))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse source '%s'", sourcePath)
+	}
+
+	outdatedKeys := []*BlockResult{}
+	for _, key := range target.Keys {
+		path := strings.Split(key, ".")
+		keyResult := &BlockResult{Name: key, Status: StatusUpToDate}
+		result.Blocks = append(result.Blocks, keyResult)
+
+		if !target.SyncsBlock(key) {
+			logger.Debugf("Target '%s': Key '%s' is excluded. Skipping", target.Path, key)
+			keyResult.Status = StatusExcluded
+
+			continue
+		}
+
+		sourceValue := lookupNode(sourceDoc.Content[0], path)
+		if sourceValue == nil {
+			logger.Warnf("Target '%s': Key '%s' not found in source. Skipping", target.Path, key)
+			keyResult.Status = StatusMissingInSource
+
+			continue
+		}
+
+		sourceLines, err := nodeLines(sourceValue)
+		if err != nil {
+			return nil, err
+		}
+
+		targetLines := []string{}
+		if targetValue := lookupNode(targetDoc.Content[0], path); targetValue != nil {
+			keyResult.StartLine = targetValue.Line
+			if targetLines, err = nodeLines(targetValue); err != nil {
+				return nil, err
+			}
+		}
+
+		if diff := linesDiff(targetLines, sourceLines); diff != "" {
+			logger.Infof("Target '%s': Key '%s' needs to be updated. Diff:\n%s\n", target.Path, key, diff)
+
+			if interactive {
+				answer, err := approveChange(target.Path, fmt.Sprintf("update key '%s'", key))
+				if err != nil {
+					return nil, err
+				}
+				if !answer {
+					logger.Infof("Target '%s': Key '%s' skipped", target.Path, key)
+					keyResult.Status = StatusSkipped
+
+					continue
+				}
+			}
+
+			keyResult.Status = StatusOutdated
+			keyResult.Diff = linesUnifiedDiff(targetLines, sourceLines)
+			outdatedKeys = append(outdatedKeys, keyResult)
+
+			if err := setNode(targetDoc.Content[0], path, sourceValue); err != nil {
+				return nil, errors.Wrapf(err, "Failed to set key '%s'", key)
+			}
+		}
+	}
+
+	if len(outdatedKeys) == 0 {
+		if lo.SomeBy(result.Blocks, func(keyResult *BlockResult) bool { return keyResult.Status == StatusSkipped }) {
+			result.Status = StatusSkipped
+		}
+
+		return result, nil
+	}
+
+	content, err := encodeStructured(structuredFormatOf(targetPath), targetDoc, detectIndent(targetContent))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to encode target '%s'", target.Path)
+	}
+	if !bytes.HasSuffix(targetContent, []byte("\n")) {
+		content = strings.TrimSuffix(content, "\n")
+	}
+
+	write := func() error { return utils.WriteStringToFile(targetPath, content) }
+
+	// In interactive mode, the updates were already approved key by key
+	return applyTargetUpdates(ctx, target, write, outdatedKeys, result, dryRun, confirm || interactive)
+}
+
+func structuredFormatOf(path string) structuredFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON
+	case ".toml":
+		return formatTOML
+	default:
+		return formatYAML
+	}
+}
+
+// parseStructured parses the content into a document node, whose content is a single mapping node
+func parseStructured(format structuredFormat, content []byte) (*yaml.Node, error) {
+	doc := &yaml.Node{}
+
+	if format == formatTOML {
+		var values map[string]interface{}
+		if err := toml.Unmarshal(content, &values); err != nil {
+			return nil, errors.Wrap(err, "Failed to unmarshal toml")
+		}
+
+		root := &yaml.Node{}
+		if err := root.Encode(values); err != nil {
+			return nil, errors.Wrap(err, "Failed to convert toml")
+		}
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{root}
+	} else if err := yaml.Unmarshal(content, doc); err != nil {
+		// JSON is parsed as YAML, which keeps the order of the keys
+		return nil, errors.Wrapf(err, "Failed to unmarshal %s", format)
+	}
+
+	if doc.Kind != yaml.DocumentNode {
+		// An empty document
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("The document must be a map")
+	}
+
+	return doc, nil
+}
+
+// encodeStructured encodes the document node in the given format and indentation
+func encodeStructured(format structuredFormat, doc *yaml.Node, indent int) (string, error) {
+	switch format {
+	case formatJSON:
+		var sb strings.Builder
+		if err := writeJSON(&sb, doc.Content[0], strings.Repeat(" ", indent), 0); err != nil {
+			return "", err
+		}
+
+		return sb.String() + "\n", nil
+	case formatTOML:
+		var values map[string]interface{}
+		if err := doc.Content[0].Decode(&values); err != nil {
+			return "", errors.Wrap(err, "Failed to convert to toml")
+		}
+
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(values); err != nil {
+			return "", errors.Wrap(err, "Failed to marshal toml")
+		}
+
+		return buf.String(), nil
+	default:
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(indent)
+		if err := encoder.Encode(doc); err != nil {
+			return "", errors.Wrap(err, "Failed to marshal yaml")
+		}
+
+		return buf.String(), nil
+	}
+}
+
+// writeJSON writes the node as indented JSON, keeping the order of the keys
+func writeJSON(sb *strings.Builder, node *yaml.Node, indent string, depth int) error {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return writeJSON(sb, node.Alias, indent, depth)
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, closing, step := "[", "]", 1
+		if node.Kind == yaml.MappingNode {
+			open, closing, step = "{", "}", 2
+		}
+
+		if len(node.Content) == 0 {
+			sb.WriteString(open + closing)
+
+			return nil
+		}
+
+		sb.WriteString(open + "\n")
+		for i := 0; i < len(node.Content); i += step {
+			sb.WriteString(strings.Repeat(indent, depth+1))
+			if node.Kind == yaml.MappingNode {
+				sb.WriteString(strconv.Quote(node.Content[i].Value) + ": ")
+			}
+			if err := writeJSON(sb, node.Content[i+step-1], indent, depth+1); err != nil {
+				return err
+			}
+			if i+step < len(node.Content) {
+				sb.WriteString(",")
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString(strings.Repeat(indent, depth) + closing)
+
+		return nil
+	default:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return errors.Wrapf(err, "Failed to decode value '%s'", node.Value)
+		}
+
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value); err != nil {
+			return errors.Wrapf(err, "Failed to marshal value '%s'", node.Value)
+		}
+		sb.WriteString(strings.TrimSuffix(buf.String(), "\n"))
+
+		return nil
+	}
+}
+
+// lookupNode returns the node at the key path, or nil if it doesn't exist.
+// Numeric keys are indexes of lists.
+func lookupNode(node *yaml.Node, path []string) *yaml.Node {
+	for _, key := range path {
+		node = childNode(node, key)
+		if node == nil {
+			return nil
+		}
+	}
+
+	return node
+}
+
+func childNode(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+
+	return nil
+}
+
+// setNode sets the value at the key path, creating missing maps along the way
+func setNode(node *yaml.Node, path []string, value *yaml.Node) error {
+	for i, key := range path {
+		last := i == len(path)-1
+
+		switch node.Kind {
+		case yaml.MappingNode:
+			child := childNode(node, key)
+			if child == nil {
+				child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+			}
+			if last {
+				*child = *value
+			}
+			node = child
+		case yaml.SequenceNode:
+			child := childNode(node, key)
+			if child == nil {
+				return errors.Errorf("Index '%s' is out of the list bounds", key)
+			}
+			if last {
+				*child = *value
+			}
+			node = child
+		default:
+			return errors.Errorf("Key '%s' is not a map or a list", strings.Join(path[:i], "."))
+		}
+	}
+
+	return nil
+}
+
+// nodeLines returns the YAML lines of the node, for comparing and diffing
+func nodeLines(node *yaml.Node) ([]string, error) {
+	b, err := yaml.Marshal(node)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal value")
+	}
+
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"), nil
+}
+
+// detectIndent returns the indentation of the first indented line, or the default indentation
+func detectIndent(content []byte) int {
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if indent := len(line) - len(trimmed); indent > 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return indent
+		}
+	}
+
+	return defaultIndent
+}
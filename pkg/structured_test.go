@@ -0,0 +1,128 @@
+package pkg_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/mocks"
+)
+
+func runStructuredTarget(t *testing.T, targetName, targetContent, sourceName, sourceContent string, keys ...string,
+) (*pkg.TargetResult, string) {
+	t.Helper()
+	r := require.New(t)
+
+	projectDir := t.TempDir()
+	r.NoError(os.WriteFile(filepath.Join(projectDir, targetName), []byte(targetContent), 0600))
+	r.NoError(os.WriteFile(filepath.Join(projectDir, sourceName), []byte(sourceContent), 0600))
+
+	target := config.Target{
+		Path:   targetName,
+		Source: config.Source{Path: sourceName},
+		Params: []config.Params{{Values: map[string]interface{}{"team": "infra"}}},
+		Keys:   keys,
+	}
+	r.NoError(target.Validate())
+
+	result, err := pkg.RunTarget(context.TODO(), projectDir, target, &mocks.ClonerMock{}, false, true, false)
+	r.NoError(err)
+
+	content, err := os.ReadFile(filepath.Join(projectDir, targetName))
+	r.NoError(err)
+
+	return result, string(content)
+}
+
+func TestRunTarget_StructuredYAML(t *testing.T) {
+	r := require.New(t)
+
+	result, content := runStructuredTarget(t, "deployment.yaml", `# the app deployment
+kind: Deployment
+spec:
+  replicas: 2 # project specific
+  template:
+    metadata:
+      labels:
+        app: old
+`, "source.yaml", `spec:
+  template:
+    metadata:
+      labels:
+        app: shared
+        team: {{ .team }}
+  strategy:
+    type: RollingUpdate
+`, "spec.template.metadata.labels", "spec.strategy", "spec.missing")
+
+	r.Equal(pkg.StatusUpdated, result.Status)
+	r.Len(result.Blocks, 3)
+	r.Equal(pkg.StatusUpdated, result.Blocks[0].Status)
+	r.Equal(pkg.StatusUpdated, result.Blocks[1].Status)
+	r.Equal(pkg.StatusMissingInSource, result.Blocks[2].Status)
+	r.Equal(`# the app deployment
+kind: Deployment
+spec:
+  replicas: 2 # project specific
+  template:
+    metadata:
+      labels:
+        app: shared
+        team: infra
+  strategy:
+    type: RollingUpdate
+`, content)
+}
+
+func TestRunTarget_StructuredJSON(t *testing.T) {
+	r := require.New(t)
+
+	result, content := runStructuredTarget(t, "package.json", `{
+    "name": "my-app",
+    "scripts": {
+        "test": "jest",
+        "build": "tsc"
+    },
+    "private": true
+}
+`, "package.json.tpl.json", `{"scripts": {"lint": "eslint <src>", "test": "jest --ci"}, "engines": {"node": ">=18"}}`,
+		"scripts.test", "scripts.lint", "engines")
+
+	r.Equal(pkg.StatusUpdated, result.Status)
+	r.Equal(`{
+    "name": "my-app",
+    "scripts": {
+        "test": "jest --ci",
+        "build": "tsc",
+        "lint": "eslint <src>"
+    },
+    "private": true,
+    "engines": {
+        "node": ">=18"
+    }
+}
+`, content)
+}
+
+func TestRunTarget_StructuredTOML(t *testing.T) {
+	r := require.New(t)
+
+	result, content := runStructuredTarget(t, "config.toml", `title = "app"
+
+[tool.lint]
+enabled = false
+`, "source.toml", `[tool.lint]
+enabled = true
+rules = ["a", "b"]
+`, "tool.lint.enabled")
+
+	r.Equal(pkg.StatusUpdated, result.Status)
+	r.Contains(content, "title = \"app\"")
+	r.Contains(content, "enabled = true")
+	r.NotContains(content, "rules")
+}
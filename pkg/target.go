@@ -2,7 +2,10 @@ package pkg
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/caarlos0/log"
 	"github.com/pkg/errors"
@@ -14,95 +17,347 @@ import (
 	"github.com/ilaif/goplicate/pkg/utils"
 )
 
-func RunTarget(ctx context.Context, target config.Target, cloner git.Cloner, dryRun, confirm bool) (bool, error) {
-	workdir := utils.MustGetwd()
+// RunTarget syncs a single target of the project residing in workdir.
+// If interactive is set, the user approves the update of every block instead of the update of the whole target.
+func RunTarget(
+	ctx context.Context,
+	workdir string,
+	target config.Target,
+	cloner git.Cloner,
+	dryRun, confirm, interactive bool,
+) (*TargetResult, error) {
+	logger := log.FromContext(ctx)
+	targetPath := filepath.Join(workdir, target.Path)
+	result := &TargetResult{Path: target.Path, Source: target.Source.String(), Status: StatusUpToDate}
 
-	sourcePath, err := ResolveSourcePath(ctx, target.Source, workdir, cloner)
+	sourceDir, err := resolveSourceDir(ctx, target.Source, workdir, cloner)
 	if err != nil {
-		return false, errors.Wrapf(err, "Failed to resolve source '%s'", target.Source.String())
+		return nil, errors.Wrapf(err, "Failed to resolve source '%s'", target.Source.String())
+	}
+	sourcePath := filepath.Join(sourceDir, target.Source.Path)
+
+	if target.Source.Repository != "" {
+		// The commit is resolved at the clone, since the source path may have been removed (e.g. mirrored files)
+		result.SourceCommit, err = git.ResolveCommit(ctx, sourceDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if target.Mirror != nil {
+		_, targetErr := os.Stat(targetPath)
+		_, sourceErr := os.Stat(sourcePath)
+		if target.Mirror.Sync || targetErr != nil || sourceErr != nil {
+			if !target.SyncsBlock(FileBlockName) {
+				logger.Debugf("Target '%s': Syncing the whole file is excluded. Skipping", target.Path)
+				result.Blocks = append(result.Blocks, &BlockResult{Name: FileBlockName, Status: StatusExcluded})
+
+				return result, nil
+			}
+
+			// A mirrored file is a single block, so in interactive mode it's approved with the target prompt
+			return runMirroredFile(ctx, target, targetPath, sourcePath, result, dryRun, confirm && !interactive)
+		}
 	}
 
 	if target.SyncInitial {
-		if _, err := os.Stat(target.Path); errors.Is(err, os.ErrNotExist) {
-			log.Infof("Syncing initial state of '%s' from '%s'", target.Path, sourcePath)
-			if err := fileutils.CopyFile(target.Path, sourcePath); err != nil {
-				return false, errors.Wrapf(err, "Failed to copy '%s' to '%s'", sourcePath, target.Path)
+		if _, err := os.Stat(targetPath); errors.Is(err, os.ErrNotExist) {
+			if dryRun {
+				logger.Infof("Target '%s': Missing. In dry-run mode - Not syncing initial state from '%s'",
+					target.Path, sourcePath)
+				result.Status = StatusMissing
+
+				return result, nil
+			}
+
+			logger.Infof("Syncing initial state of '%s' from '%s'", target.Path, sourcePath)
+			if err := fileutils.CopyFile(targetPath, sourcePath); err != nil {
+				return nil, errors.Wrapf(err, "Failed to copy '%s' to '%s'", sourcePath, target.Path)
 			}
 		}
 	}
 
-	targetBlocks, err := parseBlocksFromFile(target.Path, nil)
+	params, err := loadParams(ctx, workdir, target, cloner)
 	if err != nil {
-		return false, errors.Wrap(err, "Failed to parse target blocks")
+		return nil, err
+	}
+	if err := withBuiltinParams(ctx, workdir, target.Path, params); err != nil {
+		return nil, err
 	}
 
-	params := map[string]interface{}{}
-	for _, paramsSource := range target.Params {
-		paramsPath, err := ResolveSourcePath(ctx, paramsSource, workdir, cloner)
-		if err != nil {
-			return false, errors.Wrapf(err, "Failed to resolve source '%s'", paramsSource.String())
-		}
+	if len(target.Keys) > 0 {
+		return runStructuredTarget(ctx, target, targetPath, sourcePath, params, result, dryRun, confirm,
+			interactive && !dryRun)
+	}
 
-		var curParams map[string]interface{}
-		if err := utils.ReadYaml(paramsPath, &curParams); err != nil {
-			return false, errors.Wrap(err, "Failed to parse params")
+	targetBlocks, err := parseBlocksFromFile(targetPath, target.Markers, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse target blocks")
+	}
+
+	sourceBlocks, err := parseBlocksFromFile(sourcePath, target.Markers, params)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse source blocks")
+	}
+
+	state, err := config.LoadStateFile(workdir)
+	if err != nil {
+		return nil, err
+	}
+
+	outdatedBlocks, applied, err := syncBlocks(ctx, target, &targetBlocks, sourceBlocks, state, result,
+		interactive && !dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	insertedBlocks, err := insertMissingBlocks(ctx, target, &targetBlocks, sourceBlocks, interactive && !dryRun)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to insert missing blocks")
+	}
+	result.Blocks = append(result.Blocks, insertedBlocks...)
+	for _, blockResult := range insertedBlocks {
+		if blockResult.Status == StatusOutdated {
+			outdatedBlocks = append(outdatedBlocks, blockResult)
+			applied[blockResult.Name] = targetBlocks.Get(blockResult.Name).Lines
 		}
-		params = lo.Assign(params, curParams)
 	}
 
-	sourceBlocks, err := parseBlocksFromFile(sourcePath, params)
+	write := func() error { return utils.WriteStringToFile(targetPath, targetBlocks.Render()) }
+
+	// In interactive mode, the updates were already approved block by block
+	result, err = applyTargetUpdates(ctx, target, write, outdatedBlocks, result, dryRun, confirm || interactive)
 	if err != nil {
-		return false, errors.Wrap(err, "Failed to parse source blocks")
+		return nil, err
 	}
 
-	anyDiff := false
+	if !dryRun && (target.ThreeWayMerge || interactive) {
+		if target.ThreeWayMerge && result.Status != StatusSkipped {
+			for name, lines := range applied {
+				state.Block(target.Path, name).Applied = strings.Join(lines, "\n")
+			}
+		}
+
+		if len(state.Targets) > 0 {
+			if err := state.Save(workdir); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if result.Status == StatusUpToDate &&
+		lo.SomeBy(result.Blocks, func(block *BlockResult) bool { return block.Status == StatusSkipped }) {
+		result.Status = StatusSkipped
+	}
+
+	return result, nil
+}
+
+// syncBlocks syncs the named target blocks with the source blocks, and applies the removed blocks policy of the
+// target. Returns the results of the outdated blocks, and the source contents of every block that was synced.
+func syncBlocks(
+	ctx context.Context,
+	target config.Target,
+	targetBlocks *Blocks,
+	sourceBlocks Blocks,
+	state *config.StateFile,
+	result *TargetResult,
+	interactive bool,
+) ([]*BlockResult, map[string][]string, error) {
+	logger := log.FromContext(ctx)
+
+	outdatedBlocks := []*BlockResult{}
+	removedBlocks := []*Block{}
+	applied := map[string][]string{}
+	lineNo := 1
+
+	for _, targetBlock := range *targetBlocks {
+		startLine := lineNo
+		lineNo += len(targetBlock.Lines)
 
-	for _, targetBlock := range targetBlocks {
 		if targetBlock.Name == "" {
 			continue
 		}
 
+		blockResult := &BlockResult{Name: targetBlock.Name, Status: StatusUpToDate, StartLine: startLine}
+		result.Blocks = append(result.Blocks, blockResult)
+
+		if targetBlock.Frozen || !target.SyncsBlock(targetBlock.Name) {
+			logger.Debugf("Target '%s': Block '%s' is frozen or excluded. Skipping", target.Path, targetBlock.Name)
+			blockResult.Status = StatusExcluded
+
+			continue
+		}
+
 		sourceBlock := sourceBlocks.Get(targetBlock.Name)
 		if sourceBlock == nil {
-			log.Warnf("Target '%s': Block '%s' not found. Skipping", target.Path, targetBlock.Name)
+			blockResult.Status = StatusMissingInSource
+
+			switch target.Removed {
+			case config.RemovedKeep:
+				logger.Debugf("Target '%s': Block '%s' not found. Keeping it", target.Path, targetBlock.Name)
+			case config.RemovedRemove:
+				diff := linesDiff(targetBlock.Lines, []string{})
+				logger.Infof("Target '%s': Block '%s' was removed from the source and needs to be removed. Diff:\n%s\n",
+					target.Path, targetBlock.Name, diff)
+
+				if interactive {
+					answer, err := approveChange(target.Path, fmt.Sprintf("remove block '%s'", targetBlock.Name))
+					if err != nil {
+						return nil, nil, err
+					}
+					if !answer {
+						logger.Infof("Target '%s': Block '%s' skipped", target.Path, targetBlock.Name)
+						blockResult.Status = StatusSkipped
+
+						continue
+					}
+				}
+
+				blockResult.Status = StatusOutdated
+				blockResult.Diff = linesUnifiedDiff(targetBlock.Lines, []string{})
+				outdatedBlocks = append(outdatedBlocks, blockResult)
+				removedBlocks = append(removedBlocks, targetBlock)
+			case config.RemovedFail:
+				return nil, nil, errors.Errorf("Target '%s': Block '%s' not found in source '%s'",
+					target.Path, targetBlock.Name, target.Source.String())
+			default:
+				logger.Warnf("Target '%s': Block '%s' not found. Skipping", target.Path, targetBlock.Name)
+			}
 
 			continue
 		}
 
-		diff := targetBlock.Compare(sourceBlock.Lines)
-		if diff != "" {
-			log.Infof("Target '%s': Block '%s' needs to be updated. Diff:\n%s\n", target.Path, targetBlock.Name, diff)
+		upstream, err := syncBlock(ctx, target, targetBlock, sourceBlock, state, blockResult, interactive)
+		if err != nil {
+			return nil, nil, err
+		}
+		if upstream != nil {
+			applied[targetBlock.Name] = upstream
+		}
+		if blockResult.Status == StatusOutdated {
+			outdatedBlocks = append(outdatedBlocks, blockResult)
+		}
+	}
+
+	*targetBlocks = lo.Without(*targetBlocks, removedBlocks...)
+
+	return outdatedBlocks, applied, nil
+}
+
+// syncBlock syncs the target block with the source block in place, unless the user skips it (now, or until the
+// source changes). With three-way merge, the upstream changes are merged into the local edits of the block since
+// it was last synced. Returns the source contents that were synced, or nil if the block was skipped.
+func syncBlock(
+	ctx context.Context,
+	target config.Target,
+	targetBlock, sourceBlock *Block,
+	state *config.StateFile,
+	blockResult *BlockResult,
+	interactive bool,
+) ([]string, error) {
+	logger := log.FromContext(ctx)
+
+	synced := targetBlock.merge(sourceBlock)
+	upstream := synced.Lines
+	blockState := state.Get(target.Path, targetBlock.Name)
 
-			targetBlock.SetLines(sourceBlock.Lines)
-			anyDiff = true
+	if target.ThreeWayMerge && blockState != nil && blockState.Applied != "" {
+		lines, conflict := threeWayMerge(strings.Split(blockState.Applied, "\n"), targetBlock.Lines, synced.Lines)
+		if conflict {
+			logger.Warnf("Target '%s': Block '%s' has local edits that conflict with the source. "+
+				"Resolve the conflict markers after syncing", target.Path, targetBlock.Name)
+			blockResult.Conflict = true
 		}
+		synced = &Block{Name: targetBlock.Name, Lines: lines}
 	}
 
-	if !anyDiff {
-		return false, nil
+	diff := linesDiff(targetBlock.Lines, synced.Lines)
+	if diff == "" {
+		return upstream, nil
+	}
+
+	if blockState != nil && blockState.Skipped == contentHash(sourceBlock.Lines) {
+		logger.Infof("Target '%s': Block '%s' is skipped until the source changes", target.Path, targetBlock.Name)
+		blockResult.Status = StatusSkipped
+
+		return nil, nil
+	}
+
+	logger.Infof("Target '%s': Block '%s' needs to be updated. Diff:\n%s\n", target.Path, targetBlock.Name, diff)
+	blockResult.Diff = linesUnifiedDiff(targetBlock.Lines, synced.Lines)
+
+	if interactive {
+		choice, lines, err := approveBlock(ctx, target.Path, targetBlock.Name, targetBlock.Lines, synced.Lines)
+		if err != nil {
+			return nil, err
+		}
+		if choice == choiceSkipForever {
+			state.Block(target.Path, targetBlock.Name).Skipped = contentHash(sourceBlock.Lines)
+		}
+		if linesEqual(lines, targetBlock.Lines) {
+			logger.Infof("Target '%s': Block '%s' skipped", target.Path, targetBlock.Name)
+			blockResult.Status = StatusSkipped
+
+			return nil, nil
+		}
+
+		synced = &Block{Name: targetBlock.Name, Lines: lines}
+		blockResult.Diff = linesUnifiedDiff(targetBlock.Lines, lines)
+	}
+
+	if blockState != nil {
+		blockState.Skipped = ""
+	}
+	blockResult.Status = StatusOutdated
+	*targetBlock = *synced
+
+	return upstream, nil
+}
+
+// applyTargetUpdates writes the updates of the target, if there are outdated blocks and the user confirms
+func applyTargetUpdates(
+	ctx context.Context,
+	target config.Target,
+	write func() error,
+	outdatedBlocks []*BlockResult,
+	result *TargetResult,
+	dryRun, confirm bool,
+) (*TargetResult, error) {
+	logger := log.FromContext(ctx)
+
+	if len(outdatedBlocks) == 0 {
+		return result, nil
 	}
 
 	if dryRun {
-		log.Infof("Target '%s': In dry-run mode - Not performing any changes", target.Path)
+		logger.Infof("Target '%s': In dry-run mode - Not performing any changes", target.Path)
+		result.Status = StatusOutdated
 
-		return false, nil
+		return result, nil
 	}
 
 	question := "Do you want to apply the above changes?"
 	answer, err := utils.PromptUserYesNoQuestion(question, confirm)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	if answer {
-		if err := utils.WriteStringToFile(target.Path, targetBlocks.Render()); err != nil {
-			return false, err
+		if err := write(); err != nil {
+			return nil, err
 		}
 
-		log.Infof("Target '%s': Updated", target.Path)
+		logger.Infof("Target '%s': Updated", target.Path)
+		result.Status = StatusUpdated
 	} else {
-		log.Infof("Target '%s': Skipped", target.Path)
+		logger.Infof("Target '%s': Skipped", target.Path)
+		result.Status = StatusSkipped
+	}
+
+	for _, blockResult := range outdatedBlocks {
+		blockResult.Status = result.Status
 	}
 
-	return true, nil
+	return result, nil
 }
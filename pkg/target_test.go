@@ -2,6 +2,10 @@ package pkg_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -10,6 +14,7 @@ import (
 	"github.com/ilaif/goplicate/pkg/cmd/testutils"
 	"github.com/ilaif/goplicate/pkg/config"
 	"github.com/ilaif/goplicate/pkg/mocks"
+	"github.com/ilaif/goplicate/pkg/utils"
 )
 
 func TestRunTarget_Error_SyncingToNonExistentFile(t *testing.T) {
@@ -24,7 +29,7 @@ func TestRunTarget_Error_SyncingToNonExistentFile(t *testing.T) {
 	}
 	cloner := &mocks.ClonerMock{}
 
-	_, err := pkg.RunTarget(context.TODO(), target, cloner, false, true)
+	_, err := pkg.RunTarget(context.TODO(), utils.MustGetwd(), target, cloner, false, true, false)
 	r.ErrorContains(err, "Failed to read file")
 }
 
@@ -40,8 +45,186 @@ func TestRunTarget_Success_SyncingToNonExistentFile_WithSyncInitial(t *testing.T
 	}
 	cloner := &mocks.ClonerMock{}
 
-	_, err := pkg.RunTarget(context.TODO(), target, cloner, false, true)
+	_, err := pkg.RunTarget(context.TODO(), utils.MustGetwd(), target, cloner, false, true, false)
 	r.NoError(err)
 
 	testutils.RequireFileContains(r, "config.yaml", "key: value")
 }
+
+func TestRunTarget_BuiltinParams(t *testing.T) {
+	r := require.New(t)
+
+	projectDir := filepath.Join(t.TempDir(), "my-project")
+	r.NoError(os.MkdirAll(projectDir, 0750))
+	block := func(value string) string {
+		return "# goplicate-start:builtins\n" + value + "\n# goplicate-end:builtins\n"
+	}
+	r.NoError(os.WriteFile(filepath.Join(projectDir, "source.yaml"),
+		[]byte(block("{{ .goplicate.project }}/{{ .goplicate.target }}")), 0600))
+	r.NoError(os.WriteFile(filepath.Join(projectDir, "target.yaml"), []byte(block("")), 0600))
+
+	target := config.Target{Path: "target.yaml", Source: config.Source{Path: "source.yaml"}}
+	_, err := pkg.RunTarget(context.TODO(), projectDir, target, &mocks.ClonerMock{}, false, true, false)
+	r.NoError(err)
+
+	testutils.RequireFileContains(r, filepath.Join(projectDir, "target.yaml"), "my-project/target.yaml")
+
+	// The built-in variables don't silently replace params of the same key
+	target.Params = []config.Params{{Values: map[string]interface{}{"goplicate": "mine"}}}
+	_, err = pkg.RunTarget(context.TODO(), projectDir, target, &mocks.ClonerMock{}, false, true, false)
+	r.ErrorContains(err, "Params key 'goplicate' is reserved for the built-in variables")
+}
+
+func TestRunTarget_LayeredParams(t *testing.T) {
+	r := require.New(t)
+
+	t.Setenv("GOPLICATE_TEST_REGION", "eu-west-1")
+
+	projectDir := t.TempDir()
+	files := map[string]string{
+		"source.yaml": "# goplicate-start:params\n" +
+			"region: {{ .region }}\n" +
+			"image: {{ .service.image }}:{{ .service.tag }}\n" +
+			"replicas: {{ .service.replicas }}\n" +
+			"ports: {{ .service.ports | toJson }}\n" +
+			"# goplicate-end:params\n",
+		"target.yaml": "# goplicate-start:params\n# goplicate-end:params\n",
+		"org.yaml": "region: ${GOPLICATE_TEST_REGION}\n" +
+			"service:\n  image: app\n  tag: v1\n  replicas: 1\n  ports: [80]\n",
+		"team.json": `{"service": {"replicas": 3}}`,
+		"repo.toml": "[service]\ntag = \"${GOPLICATE_TEST_TAG:-v2}\"\n",
+	}
+	for name, content := range files {
+		r.NoError(os.WriteFile(filepath.Join(projectDir, name), []byte(content), 0600))
+	}
+
+	target := config.Target{
+		Path:   "target.yaml",
+		Source: config.Source{Path: "source.yaml"},
+		Params: []config.Params{
+			{Source: config.Source{Path: "org.yaml"}},
+			{Source: config.Source{Path: "team.json"}},
+			{Source: config.Source{Path: "repo.toml"}},
+			{
+				Values: map[string]interface{}{"service": map[string]interface{}{"ports": []interface{}{443}}},
+				Merge:  config.MergeAppend,
+			},
+		},
+	}
+	_, err := pkg.RunTarget(context.TODO(), projectDir, target, &mocks.ClonerMock{}, false, true, false)
+	r.NoError(err)
+
+	content, err := os.ReadFile(filepath.Join(projectDir, "target.yaml"))
+	r.NoError(err)
+	r.Equal("# goplicate-start:params\n"+
+		"region: eu-west-1\n"+
+		"image: app:v2\n"+
+		"replicas: 3\n"+
+		"ports: [80,443]\n"+
+		"# goplicate-end:params\n", string(content))
+}
+
+func TestRunTarget_InsertAndRemoveBlocks(t *testing.T) {
+	r := require.New(t)
+
+	block := func(name, value string) string {
+		return "# goplicate-start:" + name + "\n" + value + "\n# goplicate-end:" + name + "\n"
+	}
+	projectDir := t.TempDir()
+	r.NoError(os.WriteFile(filepath.Join(projectDir, "source.yaml"),
+		[]byte(block("a", "a: 1")+block("b", "b: 1")+block("c", "c: 1")+block("d", "d: 1")), 0600))
+	r.NoError(os.WriteFile(filepath.Join(projectDir, "target.yaml"),
+		[]byte(block("a", "a: 0")+"local: true\n"+block("old", "old: 0")), 0600))
+
+	target := config.Target{
+		Path:   "target.yaml",
+		Source: config.Source{Path: "source.yaml"},
+		Insert: []config.Insert{
+			{Block: "b", After: "a"},
+			{Block: "c", Before: "^local:"},
+			{Block: "d"},
+		},
+		Removed: config.RemovedRemove,
+	}
+	result, err := pkg.RunTarget(context.TODO(), projectDir, target, &mocks.ClonerMock{}, false, true, false)
+	r.NoError(err)
+	r.Equal(pkg.StatusUpdated, result.Status)
+
+	content, err := os.ReadFile(filepath.Join(projectDir, "target.yaml"))
+	r.NoError(err)
+	r.Equal(block("a", "a: 1")+block("b", "b: 1")+block("c", "c: 1")+"local: true\n"+block("d", "d: 1"),
+		string(content))
+
+	target.Removed = config.RemovedFail
+	r.NoError(os.WriteFile(filepath.Join(projectDir, "target.yaml"), []byte(block("old", "old: 0")), 0600))
+	_, err = pkg.RunTarget(context.TODO(), projectDir, target, &mocks.ClonerMock{}, false, true, false)
+	r.ErrorContains(err, "Block 'old' not found in source")
+}
+
+func TestRunTarget_ThreeWayMerge(t *testing.T) {
+	r := require.New(t)
+
+	block := func(value string) string {
+		return "# goplicate-start:merge\n" + value + "\n# goplicate-end:merge\n"
+	}
+	projectDir := t.TempDir()
+	sourcePath, targetPath := filepath.Join(projectDir, "source.yaml"), filepath.Join(projectDir, "target.yaml")
+	r.NoError(os.WriteFile(sourcePath, []byte(block("a: 1\nb: 1\nc: 1")), 0600))
+	r.NoError(os.WriteFile(targetPath, []byte(block("")), 0600))
+
+	target := config.Target{Path: "target.yaml", Source: config.Source{Path: "source.yaml"}, ThreeWayMerge: true}
+	run := func() *pkg.TargetResult {
+		result, err := pkg.RunTarget(context.TODO(), projectDir, target, &mocks.ClonerMock{}, false, true, false)
+		r.NoError(err)
+
+		return result
+	}
+
+	// The first sync has no base, so it replaces the block and records the base
+	run()
+	testutils.RequireFileContains(r, filepath.Join(projectDir, config.StateFilename), "a: 1")
+
+	// Local edits are kept, and upstream changes to other lines are merged into them
+	r.NoError(os.WriteFile(targetPath, []byte(block("a: local\nb: 1\nc: 1")), 0600))
+	r.NoError(os.WriteFile(sourcePath, []byte(block("a: 1\nb: 1\nc: 2")), 0600))
+	run()
+	content, err := os.ReadFile(targetPath)
+	r.NoError(err)
+	r.Equal(block("a: local\nb: 1\nc: 2"), string(content))
+
+	// Conflicting edits are marked
+	r.NoError(os.WriteFile(sourcePath, []byte(block("a: 2\nb: 1\nc: 2")), 0600))
+	result := run()
+	r.True(result.Blocks[0].Conflict)
+	testutils.RequireFileContains(r, targetPath, "<<<<<<< local\na: local\n=======\na: 2\n>>>>>>> upstream")
+}
+
+func TestRunTarget_SkippedUntilSourceChanges(t *testing.T) {
+	r := require.New(t)
+
+	block := func(value string) string {
+		return "# goplicate-start:skip\n" + value + "\n# goplicate-end:skip"
+	}
+	projectDir := t.TempDir()
+	sourcePath, targetPath := filepath.Join(projectDir, "source.yaml"), filepath.Join(projectDir, "target.yaml")
+	r.NoError(os.WriteFile(sourcePath, []byte(block("upstream: 1")+"\n"), 0600))
+	r.NoError(os.WriteFile(targetPath, []byte(block("local: 1")+"\n"), 0600))
+
+	skippedHash := sha256.Sum256([]byte(block("upstream: 1")))
+	state := &config.StateFile{}
+	state.Block("target.yaml", "skip").Skipped = hex.EncodeToString(skippedHash[:])
+	r.NoError(state.Save(projectDir))
+
+	target := config.Target{Path: "target.yaml", Source: config.Source{Path: "source.yaml"}}
+	result, err := pkg.RunTarget(context.TODO(), projectDir, target, &mocks.ClonerMock{}, false, true, false)
+	r.NoError(err)
+	r.Equal(pkg.StatusSkipped, result.Status)
+	testutils.RequireFileContains(r, targetPath, "local: 1")
+
+	// Once the source changes, the block is synced again
+	r.NoError(os.WriteFile(sourcePath, []byte(block("upstream: 2")+"\n"), 0600))
+	result, err = pkg.RunTarget(context.TODO(), projectDir, target, &mocks.ClonerMock{}, false, true, false)
+	r.NoError(err)
+	r.Equal(pkg.StatusUpdated, result.Status)
+	testutils.RequireFileContains(r, targetPath, "upstream: 2")
+}
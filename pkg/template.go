@@ -0,0 +1,296 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode"
+
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+const (
+	// BuiltinParamsKey the params key of the built-in variables, e.g. `{{ .goplicate.target }}`
+	BuiltinParamsKey = "goplicate"
+)
+
+var (
+	wordBoundaryRegex = regexp.MustCompile(`[^a-zA-Z0-9]+|([a-z0-9])([A-Z])`)
+)
+
+// templateFuncs the functions that are available in templates
+var templateFuncs = template.FuncMap{
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"title":     titleCase,
+	"camelcase": camelCase,
+	"snakecase": func(s string) string { return strings.Join(splitWords(s), "_") },
+	"kebabcase": func(s string) string { return strings.Join(splitWords(s), "-") },
+	"trim":      strings.TrimSpace,
+	"quote":     func(s interface{}) string { return strconv.Quote(fmt.Sprint(s)) },
+	"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"indent":    indent,
+	"nindent":   func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+	"default":   defaultValue,
+	"empty":     isEmpty,
+	"toYaml":    toYaml,
+	"toJson":    toJSON,
+	"env":       os.Getenv,
+	"lookup":    lookupKey,
+	"regexReplaceAll": func(regex, s, repl string) (string, error) {
+		r, err := regexp.Compile(regex)
+		if err != nil {
+			return "", errors.Wrapf(err, "Failed to compile regex '%s'", regex)
+		}
+
+		return r.ReplaceAllString(s, repl), nil
+	},
+}
+
+// renderTemplate renders the template text with the given data. Missing keys are errors, unless they are given
+// a default value (e.g. `{{ .tag | default "latest" }}`).
+func renderTemplate(name, text string, data interface{}) (string, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to parse template")
+	}
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			optionalDefaultFields(tmpl.Tree.Root)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", errors.Wrap(err, "Failed to execute template")
+	}
+
+	return buf.String(), nil
+}
+
+// withBuiltinParams adds the built-in variables of the target residing in workdir to the params, under the
+// BuiltinParamsKey key, which the params cannot have themselves
+func withBuiltinParams(ctx context.Context, workdir, targetPath string, params map[string]interface{}) error {
+	if _, ok := params[BuiltinParamsKey]; ok {
+		return errors.Errorf("Params key '%s' is reserved for the built-in variables. Rename it", BuiltinParamsKey)
+	}
+	params[BuiltinParamsKey] = builtinParams(ctx, workdir, targetPath)
+
+	return nil
+}
+
+// builtinParams returns the built-in variables of the target residing in workdir:
+// the target path, the project name and the name of the project's repository (if it has an origin remote)
+func builtinParams(ctx context.Context, workdir, targetPath string) map[string]interface{} {
+	repository := ""
+	output, err := utils.NewCommandRunner(workdir).Run(ctx, "git", "config", "--get", "remote.origin.url")
+	if err != nil {
+		log.FromContext(ctx).WithError(err).Debugf("Failed to get the remote origin url of '%s'", workdir)
+	} else {
+		repository = strings.TrimSuffix(filepath.Base(strings.TrimSpace(output)), ".git")
+	}
+
+	return map[string]interface{}{
+		"target":     targetPath,
+		"project":    filepath.Base(workdir),
+		"repository": repository,
+	}
+}
+
+func titleCase(s string) string {
+	prev := ' '
+
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsSpace(prev) {
+			return unicode.ToTitle(r)
+		}
+
+		return r
+	}, s)
+}
+
+func camelCase(s string) string {
+	words := splitWords(s)
+	for i, word := range words {
+		if i > 0 {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+
+	return strings.Join(words, "")
+}
+
+// splitWords splits the string into lower-cased words by non-alphanumeric characters and camel case boundaries
+func splitWords(s string) []string {
+	s = wordBoundaryRegex.ReplaceAllString(s, "$1 $2")
+
+	return lo.Map(strings.Fields(s), func(word string, _ int) string { return strings.ToLower(word) })
+}
+
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// defaultValue returns the given value, or defaultVal if the value is missing or empty
+func defaultValue(defaultVal interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || isEmpty(given[0]) {
+		return defaultVal
+	}
+
+	return given[0]
+}
+
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+func toYaml(value interface{}) (string, error) {
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to marshal to yaml")
+	}
+
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+func toJSON(value interface{}) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to marshal to json")
+	}
+
+	return string(b), nil
+}
+
+// optionalDefaultFields rewrites the fields that are given a default value (`{{ .a.b | default "x" }}` or
+// `{{ default "x" .a.b }}`) into key lookups (`lookup . "a" "b"`), so they are not errors when they are missing
+func optionalDefaultFields(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			optionalDefaultFields(child)
+		}
+	case *parse.ActionNode:
+		optionalDefaultPipe(n.Pipe)
+	case *parse.IfNode:
+		optionalDefaultBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		optionalDefaultBranch(&n.BranchNode)
+	case *parse.WithNode:
+		optionalDefaultBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		optionalDefaultPipe(n.Pipe)
+	}
+}
+
+func optionalDefaultBranch(branch *parse.BranchNode) {
+	optionalDefaultPipe(branch.Pipe)
+	optionalDefaultFields(branch.List)
+	optionalDefaultFields(branch.ElseList)
+}
+
+func optionalDefaultPipe(pipe *parse.PipeNode) {
+	if pipe == nil {
+		return
+	}
+
+	for i, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			if subPipe, ok := arg.(*parse.PipeNode); ok {
+				optionalDefaultPipe(subPipe)
+			}
+		}
+
+		if identifier, ok := cmd.Args[0].(*parse.IdentifierNode); !ok || identifier.Ident != "default" {
+			continue
+		}
+
+		// `default DEFAULT VALUE`
+		if len(cmd.Args) == 3 {
+			if lookup := lookupCommand(cmd.Args[2]); lookup != nil {
+				cmd.Args[2] = &parse.PipeNode{NodeType: parse.NodePipe, Pos: lookup.Pos,
+					Cmds: []*parse.CommandNode{lookup}}
+			}
+		}
+
+		// `VALUE | default DEFAULT`
+		if i == 0 || len(pipe.Cmds[i-1].Args) != 1 {
+			continue
+		}
+		if lookup := lookupCommand(pipe.Cmds[i-1].Args[0]); lookup != nil {
+			pipe.Cmds[i-1].Args = lookup.Args
+		}
+	}
+}
+
+// lookupCommand returns a command that looks up the keys of the field (e.g. `.a.b` or `$.a.b`) without failing
+// when they are missing, or nil if the node is not a field
+func lookupCommand(node parse.Node) *parse.CommandNode {
+	var receiver parse.Node
+	var keys []string
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		receiver, keys = &parse.DotNode{NodeType: parse.NodeDot, Pos: n.Pos}, n.Ident
+	case *parse.VariableNode:
+		if len(n.Ident) < 2 {
+			return nil
+		}
+		receiver = &parse.VariableNode{NodeType: parse.NodeVariable, Pos: n.Pos, Ident: n.Ident[:1]}
+		keys = n.Ident[1:]
+	default:
+		return nil
+	}
+
+	args := []parse.Node{parse.NewIdentifier("lookup").SetPos(node.Position()), receiver}
+	for _, key := range keys {
+		args = append(args, &parse.StringNode{NodeType: parse.NodeString, Pos: node.Position(),
+			Quoted: strconv.Quote(key), Text: key})
+	}
+
+	return &parse.CommandNode{NodeType: parse.NodeCommand, Pos: node.Position(), Args: args}
+}
+
+// lookupKey returns the value at the keys of the nested maps of data, or nil if it's missing
+func lookupKey(data interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		data = m[key]
+	}
+
+	return data
+}
@@ -1,24 +1,23 @@
 package utils
 
 import (
-	"os"
+	"path/filepath"
 
-	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
 )
 
-func ChWorkdir(args []string) (string, func(), error) {
+// ResolveWorkdir returns the absolute path of the working directory given as the first argument,
+// or of the current directory if no arguments were supplied.
+func ResolveWorkdir(args []string) (string, error) {
 	workdir := "."
 	if len(args) > 0 {
 		workdir = args[0]
 	}
 
-	origWorkdir := MustGetwd()
-	if err := Chdir(workdir); err != nil {
-		return workdir, nil, err
+	absWorkdir, err := filepath.Abs(workdir)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to get absolute path for '%s'", workdir)
 	}
 
-	return workdir, func() {
-		log.Debugf("Cleanup: Restoring original working directory '%s'", origWorkdir)
-		_ = os.Chdir(origWorkdir)
-	}, nil
+	return absWorkdir, nil
 }
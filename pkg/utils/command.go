@@ -21,7 +21,7 @@ func (c *CommandRunner) Run(ctx context.Context, name string, args ...string) (s
 	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Dir = c.Dir
 
-	log.Debugf("Running command '%s %s' in directory '%s'", name, strings.Join(args, " "), c.Dir)
+	log.FromContext(ctx).Debugf("Running command '%s %s' in directory '%s'", name, strings.Join(args, " "), c.Dir)
 
 	bytes, err := cmd.CombinedOutput()
 	if err != nil {
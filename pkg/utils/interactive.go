@@ -33,6 +33,24 @@ func PromptUserYesNoQuestion(question string, confirm bool) (bool, error) {
 	return continueToAuth, nil
 }
 
+// PromptUserSelect ask a question with the given options and wait for the user to select one of them.
+func PromptUserSelect(question string, options []string) (string, error) {
+	var answer string
+
+	if err := survey.AskOne(&survey.Select{
+		Message: question,
+		Options: options,
+	}, &answer); err != nil {
+		if err == terminal.InterruptErr {
+			return "", errors.Wrap(err, "user interrupt")
+		}
+
+		return "", errors.Wrap(err, "prompt error")
+	}
+
+	return answer, nil
+}
+
 // OpenTextEditor opens the default text editor and capturing its input.
 func OpenTextEditor(ctx context.Context, initMsg string) (string, error) {
 	editor := os.Getenv("EDITOR")
@@ -2,8 +2,6 @@ package utils
 
 import (
 	"os"
-
-	"github.com/pkg/errors"
 )
 
 func MustGetwd() string {
@@ -14,11 +12,3 @@ func MustGetwd() string {
 
 	return wd
 }
-
-func Chdir(dir string) error {
-	if err := os.Chdir(dir); err != nil {
-		return errors.Wrap(err, "Failed to change directory")
-	}
-
-	return nil
-}
@@ -0,0 +1,238 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/git"
+	"github.com/ilaif/goplicate/pkg/utils"
+)
+
+// ErrInvalid returned when the configs, blocks or templates of a project have issues
+var ErrInvalid = errors.New("Validation failed")
+
+// Validate validates the project config and the projects config that reside in projectDir (whichever exist)
+// without performing any changes: the configs against their JSON schemas and rules, the block markers of every
+// target and source (malformed, unclosed or duplicate blocks), and the rendering of every source block with the
+// params of its target. Returns the issues that were found.
+func Validate(ctx context.Context, projectDir string, cloner git.Cloner) ([]config.Issue, error) {
+	logger := log.FromContext(ctx)
+
+	_, projectErr := os.Stat(filepath.Join(projectDir, config.DefaultProjectConfigFilename))
+	_, projectsErr := os.Stat(filepath.Join(projectDir, config.DefaultProjectsConfigFilename))
+	if projectErr != nil && projectsErr != nil {
+		return nil, errors.Errorf("Neither '%s' nor '%s' were found in '%s'",
+			config.DefaultProjectConfigFilename, config.DefaultProjectsConfigFilename, projectDir)
+	}
+
+	issues := []config.Issue{}
+	if projectsErr == nil {
+		logger.Debugf("Validating '%s'", config.DefaultProjectsConfigFilename)
+		projectsIssues, err := config.ValidateProjectsConfigFile(projectDir)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, projectsIssues...)
+	}
+
+	if projectErr != nil {
+		return issues, nil
+	}
+
+	logger.Debugf("Validating '%s'", config.DefaultProjectConfigFilename)
+	projectIssues, err := config.ValidateProjectConfigFile(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(projectIssues) > 0 {
+		// The targets of an invalid config can't be trusted
+		return append(issues, projectIssues...), nil
+	}
+
+	cfg, err := config.LoadProjectConfig(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	configLines, err := config.LoadProjectConfigLines(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The issues of a target are reported at its node in the project config
+	targets := cfg.Targets
+	pointers := lo.Map(cfg.Targets, func(_ config.Target, i int) string { return "/targets/" + strconv.Itoa(i) })
+	if cfg.SyncConfig != nil {
+		targets = append([]config.Target{*cfg.SyncConfig}, targets...)
+		pointers = append([]string{"/sync-config"}, pointers...)
+	}
+
+	for i, target := range targets {
+		line := configLines(pointers[i])
+		fileTargets, err := ExpandTarget(ctx, projectDir, target, cloner)
+		if err != nil {
+			issues = append(issues, targetIssue(target, line, err))
+
+			continue
+		}
+
+		for _, fileTarget := range fileTargets {
+			logger.Debugf("Target '%s': Validating blocks and templates", fileTarget.Path)
+			issues = append(issues, validateTarget(ctx, projectDir, fileTarget, line, cloner)...)
+		}
+	}
+
+	return issues, nil
+}
+
+// validateTarget returns the issues of the blocks of the target and its source, and of rendering the source blocks
+// with the params of the target. targetLine is the line of the target in the project config.
+func validateTarget(
+	ctx context.Context,
+	workdir string,
+	target config.Target,
+	targetLine int,
+	cloner git.Cloner,
+) []config.Issue {
+	sourcePath, err := ResolveSourcePath(ctx, target.Source, workdir, cloner)
+	if err != nil {
+		return []config.Issue{targetIssue(target, targetLine, errors.Wrapf(err, "Failed to resolve source '%s'",
+			target.Source.String()))}
+	}
+
+	targetPath := filepath.Join(workdir, target.Path)
+	_, targetErr := os.Stat(targetPath)
+	_, sourceErr := os.Stat(sourcePath)
+	if sourceErr != nil && target.Mirror == nil {
+		return []config.Issue{targetIssue(target, targetLine,
+			errors.Errorf("Source '%s' doesn't exist", target.Source.String()))}
+	}
+
+	// Whole files and key paths are synced without blocks
+	if len(target.Keys) > 0 || (target.Mirror != nil && (target.Mirror.Sync || targetErr != nil || sourceErr != nil)) {
+		return nil
+	}
+
+	issues := []config.Issue{}
+	if targetErr == nil {
+		_, targetIssues, err := validateBlocksFile(targetPath, target.Path, target.Markers)
+		if err != nil {
+			return []config.Issue{targetIssue(target, targetLine, err)}
+		}
+		issues = append(issues, targetIssues...)
+	}
+
+	sourceName := target.Source.String()
+	sourceBlocks, sourceIssues, err := validateBlocksFile(sourcePath, sourceName, target.Markers)
+	if err != nil {
+		return []config.Issue{targetIssue(target, targetLine, err)}
+	}
+	issues = append(issues, sourceIssues...)
+	if len(sourceIssues) > 0 {
+		return issues
+	}
+
+	params, err := loadParams(ctx, workdir, target, cloner)
+	if err != nil {
+		return append(issues, targetIssue(target, targetLine, err))
+	}
+	if err := withBuiltinParams(ctx, workdir, target.Path, params); err != nil {
+		return append(issues, targetIssue(target, targetLine, err))
+	}
+
+	for i, block := range sourceBlocks {
+		if block.Name == "" {
+			continue
+		}
+
+		rendered := &Block{}
+		*rendered = *block
+		if err := rendered.render(params); err != nil {
+			message := fmt.Sprintf("Block '%s' fails to render with the params of target '%s': %s",
+				block.Name, target.Path, err)
+			line := templateErrorLine(block.Name, err, sourceBlocks.startLine(i))
+			issues = append(issues, config.Issue{File: sourceName, Line: line, Message: message})
+		}
+	}
+
+	return issues
+}
+
+// validateBlocksFile parses the blocks of the file, and returns them along with the issues of their markers:
+// malformed, unclosed or duplicate blocks. name is the name of the file to report the issues with.
+func validateBlocksFile(filename, name string, markers *config.Markers) (Blocks, []config.Issue, error) {
+	fileBytes, err := utils.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blocks, err := parseBlocksFromLines(strings.Split(string(fileBytes), "\n"), newMarkerParser(filename, markers))
+	if err != nil {
+		issue := config.Issue{File: name, Message: err.Error()}
+		lineErr := &lineError{}
+		if errors.As(err, &lineErr) {
+			issue.Line, issue.Message = lineErr.line, lineErr.err.Error()
+		}
+
+		return nil, []config.Issue{issue}, nil
+	}
+
+	issues := []config.Issue{}
+	firstLines := map[string]int{}
+	var visit func(block *Block, line int)
+	visit = func(block *Block, line int) {
+		if first, ok := firstLines[block.Name]; ok {
+			issues = append(issues, config.Issue{
+				File:    name,
+				Line:    line,
+				Message: fmt.Sprintf("Block '%s' is duplicated. It first starts at line %d", block.Name, first),
+			})
+		} else {
+			firstLines[block.Name] = line
+		}
+
+		for _, child := range block.Children {
+			visit(child, line+child.offset)
+		}
+	}
+	for i, block := range blocks {
+		if block.Name != "" {
+			visit(block, blocks.startLine(i))
+		}
+	}
+
+	return blocks, issues, nil
+}
+
+// templateErrorLine returns the line of the file that the error of rendering the block's template points to,
+// or the first line of the block if it doesn't point to any
+func templateErrorLine(blockName string, err error, blockLine int) int {
+	regex := regexp.MustCompile(`template: ` + regexp.QuoteMeta(blockName) + `:(\d+)`)
+	matches := regex.FindStringSubmatch(err.Error())
+	if matches == nil {
+		return blockLine
+	}
+
+	line, _ := strconv.Atoi(matches[1])
+
+	return blockLine + line - 1
+}
+
+// targetIssue returns the issue of a target that is reported at its line in the project config
+func targetIssue(target config.Target, line int, err error) config.Issue {
+	return config.Issue{
+		File:    config.DefaultProjectConfigFilename,
+		Line:    line,
+		Message: errors.Wrapf(err, "Target '%s'", target.Path).Error(),
+	}
+}
@@ -0,0 +1,176 @@
+package pkg_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilaif/goplicate/pkg"
+	"github.com/ilaif/goplicate/pkg/config"
+	"github.com/ilaif/goplicate/pkg/mocks"
+)
+
+func writeFiles(r *require.Assertions, dir string, files map[string]string) {
+	for name, content := range files {
+		r.NoError(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0750))
+		r.NoError(os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+}
+
+func issueStrings(issues []config.Issue) []string {
+	return lo.Map(issues, func(issue config.Issue, _ int) string { return issue.String() })
+}
+
+func TestValidate_Valid(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	writeFiles(r, dir, map[string]string{
+		".goplicate.yaml": "targets:\n" +
+			"  - path: config.yaml\n" +
+			"    source:\n" +
+			"      path: shared/config.yaml\n" +
+			"    params:\n" +
+			"      - values:\n" +
+			"          name: app\n",
+		"config.yaml":        "# goplicate-start:settings\nname: old\n# goplicate-end:settings\n",
+		"shared/config.yaml": "# goplicate-start:settings\nname: {{ .name }}\n# goplicate-end:settings\n",
+	})
+
+	issues, err := pkg.Validate(context.TODO(), dir, &mocks.ClonerMock{})
+	r.NoError(err)
+	r.Empty(issues)
+}
+
+func TestValidate_ConfigIssues(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	writeFiles(r, dir, map[string]string{
+		".goplicate.yaml": "targets:\n" +
+			"  - path: config.yaml\n" +
+			"    source:\n" +
+			"      path: shared/config.yaml\n" +
+			"      sync-initial: true\n" +
+			"    removed: never\n" +
+			"  - source:\n" +
+			"      path: shared/config.yaml\n" +
+			"publish:\n" +
+			"  labelz: [sync]\n",
+		".goplicate-projects.yaml": "projects:\n" +
+			"  - location:\n" +
+			"      path: repo-1\n" +
+			"      repository: https://github.com/org/repo-1\n",
+	})
+
+	issues, err := pkg.Validate(context.TODO(), dir, &mocks.ClonerMock{})
+	r.NoError(err)
+	r.ElementsMatch([]string{
+		".goplicate-projects.yaml:2: 'projects/0': Project is invalid: " +
+			"Exactly one of 'repository', 'path' should be specified",
+		".goplicate.yaml:5: Unknown key 'targets/0/source/sync-initial'",
+		".goplicate.yaml:6: 'targets/0/removed': value must be one of \"keep\", \"warn\", \"remove\", \"fail\"",
+		".goplicate.yaml:7: 'targets/1': missing properties: 'path'",
+		".goplicate.yaml:10: Unknown key 'publish/labelz'",
+	}, issueStrings(issues))
+}
+
+func TestValidate_InvalidYaml(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	writeFiles(r, dir, map[string]string{
+		".goplicate.yaml": "targets:\n  - path: config.yaml\n  source: [\n",
+	})
+
+	issues, err := pkg.Validate(context.TODO(), dir, &mocks.ClonerMock{})
+	r.NoError(err)
+	r.Len(issues, 1)
+	r.Equal(".goplicate.yaml", issues[0].File)
+	r.Contains(issues[0].Message, "Invalid YAML")
+	r.NotZero(issues[0].Line)
+}
+
+func TestValidate_BlockAndTemplateIssues(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	writeFiles(r, dir, map[string]string{
+		".goplicate.yaml": "targets:\n" +
+			"  - path: unclosed.yaml\n" +
+			"    source:\n" +
+			"      path: shared/config.yaml\n" +
+			"  - path: duplicate.yaml\n" +
+			"    source:\n" +
+			"      path: shared/config.yaml\n" +
+			"  - path: interleaved.yaml\n" +
+			"    source:\n" +
+			"      path: shared/template.yaml\n" +
+			"    params:\n" +
+			"      - values:\n" +
+			"          name: app\n",
+		"unclosed.yaml": "a: 1\n# goplicate-start:settings\nname: old\n",
+		"duplicate.yaml": "# goplicate-start:settings\nname: old\n# goplicate-end:settings\n" +
+			"# goplicate-start:settings\nname: old\n# goplicate-end:settings\n",
+		"interleaved.yaml": "# goplicate-start:outer\n# goplicate-start:inner\n# goplicate-end:outer\n" +
+			"# goplicate-end:inner\n",
+		"shared/config.yaml": "# goplicate-start:settings\nname: new\n# goplicate-end:settings\n",
+		"shared/template.yaml": "# goplicate-start:settings\nname: {{ .name }}\nport: {{ .port }}\n" +
+			"# goplicate-end:settings\n" +
+			"# goplicate-start:broken\n{{ if .name }}\n# goplicate-end:broken\n",
+	})
+
+	issues, err := pkg.Validate(context.TODO(), dir, &mocks.ClonerMock{})
+	r.NoError(err)
+	r.Len(issues, 5)
+	r.Equal("unclosed.yaml:2: Every block must have an 'end' position, but block 'settings' doesn't",
+		issues[0].String())
+	r.Equal("duplicate.yaml:4: Block 'settings' is duplicated. It first starts at line 1", issues[1].String())
+	r.Equal("interleaved.yaml:3: Block 'outer' ends before its nested block 'inner'. Blocks cannot be interleaved",
+		issues[2].String())
+	r.Equal("shared/template.yaml", issues[3].File)
+	r.Equal(3, issues[3].Line)
+	r.Contains(issues[3].Message, "Block 'settings' fails to render with the params of target 'interleaved.yaml'")
+	r.Contains(issues[3].Message, "map has no entry for key \"port\"")
+	r.Equal("shared/template.yaml", issues[4].File)
+	r.Contains(issues[4].Message, "Block 'broken' fails to render")
+}
+
+func TestValidate_TargetIssues(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	writeFiles(r, dir, map[string]string{
+		".goplicate.yaml": "sync-config:\n" +
+			"  path: .goplicate.yaml\n" +
+			"  source:\n" +
+			"    path: shared/.goplicate.yaml\n" +
+			"targets:\n" +
+			"  - path: config.yaml\n" +
+			"    source:\n" +
+			"      path: shared/config.yaml\n" +
+			"  - path: other.yaml\n" +
+			"    source:\n" +
+			"      path: shared/other.yaml\n",
+		"config.yaml":        "# goplicate-start:settings\nname: old\n# goplicate-end:settings\n",
+		"shared/config.yaml": "# goplicate-start:settings\nname: new\n# goplicate-end:settings\n",
+	})
+
+	issues, err := pkg.Validate(context.TODO(), dir, &mocks.ClonerMock{})
+	r.NoError(err)
+	r.Equal([]string{
+		".goplicate.yaml:2: Target '.goplicate.yaml': Source 'shared/.goplicate.yaml' doesn't exist",
+		".goplicate.yaml:9: Target 'other.yaml': Source 'shared/other.yaml' doesn't exist",
+	}, issueStrings(issues))
+}
+
+func TestValidate_NoConfig(t *testing.T) {
+	r := require.New(t)
+
+	_, err := pkg.Validate(context.TODO(), t.TempDir(), &mocks.ClonerMock{})
+	r.ErrorContains(err, "Neither '.goplicate.yaml' nor '.goplicate-projects.yaml' were found")
+}